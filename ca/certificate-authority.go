@@ -6,13 +6,19 @@
 package ca
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/letsencrypt/boulder/core"
@@ -35,6 +41,10 @@ type Config struct {
 	DBConnect    string
 	SerialPrefix int
 	Key          KeyConfig
+	// SignatureAlgorithm names the algorithm used to sign certificates and
+	// OCSP responses, e.g. "SHA256WithRSA" or "ECDSAWithSHA384". If it is
+	// empty, the algorithm is chosen to suit the issuer key.
+	SignatureAlgorithm string
 	// LifespanOCSP is how long OCSP responses are valid for; It should be longer
 	// than the minTimeToExpiry field for the OCSP Updater.
 	LifespanOCSP string
@@ -43,12 +53,38 @@ type Config struct {
 	Expiry string
 	// The maximum number of subjectAltNames in a single certificate
 	MaxNames int
-	CFSSL    cfsslConfig.Config
+	// EnforceAuthzLifetime makes the CA refuse certificates that would
+	// expire after the shortest underlying authorization, rather than just
+	// logging a notice.
+	EnforceAuthzLifetime bool
+	CFSSL                cfsslConfig.Config
+
+	// Issuers lists the intermediates the CA issues under. If it is empty,
+	// the CA issues under the single intermediate made up of Key and the
+	// issuer certificate passed to NewCertificateAuthorityImpl.
+	Issuers []IssuerConfig
 
 	// DebugAddr is the address to run the /debug handlers on.
 	DebugAddr string
 }
 
+// IssuerConfig describes one intermediate the CA can issue under.
+type IssuerConfig struct {
+	Key      KeyConfig
+	CertFile string
+	// Profile is the CFSSL signing profile used with this issuer. If it is
+	// empty, the CA's Profile is used.
+	Profile string
+	// SignatureAlgorithm is as in Config, but applies to this issuer's key.
+	SignatureAlgorithm string
+	// Only active issuers sign new certificates. Inactive issuers still sign
+	// OCSP responses for the certificates they issued.
+	Active bool
+	// Weight is this issuer's share of new certificates, relative to the
+	// other active issuers with the same type of key. Zero counts as one.
+	Weight int
+}
+
 // KeyConfig should contain either a File path to a PEM-format private key,
 // or a PKCS11Config defining how to load a module for an HSM.
 type KeyConfig struct {
@@ -80,21 +116,54 @@ var badSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
 	x509.ECDSAWithSHA1:             true,
 }
 
+// These are the algorithms the CA can be configured to sign with, and the
+// type of key each one needs.
+var signatureAlgorithms = map[string]struct {
+	algorithm x509.SignatureAlgorithm
+	keyType   x509.PublicKeyAlgorithm
+}{
+	"SHA256WithRSA":   {x509.SHA256WithRSA, x509.RSA},
+	"SHA384WithRSA":   {x509.SHA384WithRSA, x509.RSA},
+	"SHA512WithRSA":   {x509.SHA512WithRSA, x509.RSA},
+	"ECDSAWithSHA256": {x509.ECDSAWithSHA256, x509.ECDSA},
+	"ECDSAWithSHA384": {x509.ECDSAWithSHA384, x509.ECDSA},
+	"ECDSAWithSHA512": {x509.ECDSAWithSHA512, x509.ECDSA},
+}
+
+// Issuer is an intermediate that the CA signs certificates and OCSP
+// responses under.
+type Issuer struct {
+	Cert       *x509.Certificate
+	Signer     signer.Signer
+	OCSPSigner ocsp.Signer
+	Profile    string
+	// NotAfter bounds the expiry of certificates from this issuer. It is
+	// normally the expiry of Cert.
+	NotAfter time.Time
+	Active   bool
+	Weight   int
+
+	// Running total used for weighted rotation between issuers
+	rotation int
+}
+
 // CertificateAuthorityImpl represents a CA that signs certificates, CRLs, and
 // OCSP responses.
 type CertificateAuthorityImpl struct {
-	profile        string
-	Signer         signer.Signer
-	OCSPSigner     ocsp.Signer
+	Issuers        []*Issuer
+	issuerLock     sync.Mutex
 	SA             core.StorageAuthority
 	PA             core.PolicyAuthority
 	DB             core.CertificateAuthorityDatabase
 	log            *blog.AuditLogger
 	Prefix         int // Prepended to the serial number
 	ValidityPeriod time.Duration
-	NotAfter       time.Time
 	MaxNames       int
 	MaxKeySize     int
+
+	// EnforceAuthzLifetime refuses to issue certificates that would expire
+	// after the shortest authorization they rely on.
+	EnforceAuthzLifetime bool
 }
 
 // NewCertificateAuthorityImpl creates a CA that talks to a remote CFSSL
@@ -125,61 +194,169 @@ func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config
 		return nil, err
 	}
 
-	// Load the private key, which can be a file or a PKCS#11 key.
-	priv, err := loadKey(config.Key)
+	if config.LifespanOCSP == "" {
+		return nil, errors.New("Config must specify an OCSP lifespan period.")
+	}
+	lifespanOCSP, err := time.ParseDuration(config.LifespanOCSP)
 	if err != nil {
 		return nil, err
 	}
 
-	issuer, err := loadIssuer(issuerCert)
+	issuerConfigs := config.Issuers
+	if len(issuerConfigs) == 0 {
+		issuerConfigs = []IssuerConfig{IssuerConfig{
+			Key:                config.Key,
+			CertFile:           issuerCert,
+			SignatureAlgorithm: config.SignatureAlgorithm,
+			Active:             true,
+		}}
+	}
+	var issuers []*Issuer
+	active := false
+	for _, issuerConfig := range issuerConfigs {
+		if issuerConfig.Profile == "" {
+			issuerConfig.Profile = config.Profile
+		}
+		issuer, err := newIssuer(issuerConfig, cfsslConfigObj.Signing, lifespanOCSP)
+		if err != nil {
+			return nil, err
+		}
+		issuers = append(issuers, issuer)
+		active = active || issuer.Active
+	}
+	if !active {
+		return nil, errors.New("Config must specify at least one active issuer.")
+	}
+
+	pa := policy.NewPolicyAuthorityImpl()
+
+	ca = &CertificateAuthorityImpl{
+		Issuers: issuers,
+		PA:      pa,
+		DB:      cadb,
+		Prefix:  config.SerialPrefix,
+		log:     logger,
+	}
+
+	if config.Expiry == "" {
+		return nil, errors.New("Config must specify an expiry period.")
+	}
+	ca.ValidityPeriod, err = time.ParseDuration(config.Expiry)
 	if err != nil {
 		return nil, err
 	}
 
-	signer, err := local.NewSigner(priv, issuer, x509.SHA256WithRSA, cfsslConfigObj.Signing)
+	ca.MaxNames = config.MaxNames
+	ca.EnforceAuthzLifetime = config.EnforceAuthzLifetime
+
+	return ca, nil
+}
+
+// newIssuer loads an issuer's key and certificate, and sets up its signers.
+func newIssuer(config IssuerConfig, policy *cfsslConfig.Signing, lifespanOCSP time.Duration) (*Issuer, error) {
+	// Load the private key, which can be a file or a PKCS#11 key.
+	priv, err := loadKey(config.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	if config.LifespanOCSP == "" {
-		return nil, errors.New("Config must specify an OCSP lifespan period.")
+	cert, err := loadIssuer(config.CertFile)
+	if err != nil {
+		return nil, err
 	}
-	lifespanOCSP, err := time.ParseDuration(config.LifespanOCSP)
+	if !core.KeyDigestEquals(priv.Public(), cert.PublicKey) {
+		return nil, fmt.Errorf("Issuer key does not match certificate %s", config.CertFile)
+	}
+
+	sigAlgo, err := signatureAlgorithm(config.SignatureAlgorithm, priv)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set up our OCSP signer. Note this calls for both the issuer cert and the
-	// OCSP signing cert, which are the same in our case.
-	ocspSigner, err := ocsp.NewSigner(issuer, issuer, priv, lifespanOCSP)
+	signer, err := local.NewSigner(priv, cert, sigAlgo, policy)
 	if err != nil {
 		return nil, err
 	}
 
-	pa := policy.NewPolicyAuthorityImpl()
+	return &Issuer{
+		Cert:   cert,
+		Signer: signer,
+		// The issuer cert is also the OCSP signing cert, and responses are
+		// signed with the same algorithm as certificates.
+		OCSPSigner: &ocspSigner{
+			issuer:    cert,
+			key:       priv,
+			algorithm: sigAlgo,
+			interval:  lifespanOCSP,
+		},
+		Profile:  config.Profile,
+		NotAfter: cert.NotAfter,
+		Active:   config.Active,
+		Weight:   config.Weight,
+	}, nil
+}
 
-	ca = &CertificateAuthorityImpl{
-		Signer:     signer,
-		OCSPSigner: ocspSigner,
-		profile:    config.Profile,
-		PA:         pa,
-		DB:         cadb,
-		Prefix:     config.SerialPrefix,
-		log:        logger,
-		NotAfter:   issuer.NotAfter,
+// chooseIssuer picks the active issuer to sign a certificate for a key of the
+// given type. Issuers with the same type of key are preferred, and among
+// those the choice rotates in proportion to their weights.
+func (ca *CertificateAuthorityImpl) chooseIssuer(keyType x509.PublicKeyAlgorithm) (*Issuer, error) {
+	var candidates []*Issuer
+	for _, issuer := range ca.Issuers {
+		if issuer.Active && issuer.Cert.PublicKeyAlgorithm == keyType {
+			candidates = append(candidates, issuer)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, issuer := range ca.Issuers {
+			if issuer.Active {
+				candidates = append(candidates, issuer)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("No active issuer")
+	}
+
+	// Smooth weighted round-robin: each candidate's running total grows by its
+	// weight, and the one with the highest total is chosen and set back by the
+	// sum of the weights. This spreads each issuer's turns evenly.
+	ca.issuerLock.Lock()
+	defer ca.issuerLock.Unlock()
+	var chosen *Issuer
+	total := 0
+	for _, issuer := range candidates {
+		weight := issuer.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		issuer.rotation += weight
+		total += weight
+		if chosen == nil || issuer.rotation > chosen.rotation {
+			chosen = issuer
+		}
 	}
+	chosen.rotation -= total
+	return chosen, nil
+}
 
-	if config.Expiry == "" {
-		return nil, errors.New("Config must specify an expiry period.")
+// issuerOf returns the issuer that signed a certificate, whether or not it
+// is still active.
+func (ca *CertificateAuthorityImpl) issuerOf(cert *x509.Certificate) (*Issuer, error) {
+	for _, issuer := range ca.Issuers {
+		if bytes.Equal(cert.RawIssuer, issuer.Cert.RawSubject) && cert.CheckSignatureFrom(issuer.Cert) == nil {
+			return issuer, nil
+		}
 	}
-	ca.ValidityPeriod, err = time.ParseDuration(config.Expiry)
+	return nil, errors.New("Certificate was not signed by any of this CA's issuers")
+}
+
+// signOCSP signs an OCSP response with the issuer of the certificate.
+func (ca *CertificateAuthorityImpl) signOCSP(req ocsp.SignRequest) ([]byte, error) {
+	issuer, err := ca.issuerOf(req.Certificate)
 	if err != nil {
 		return nil, err
 	}
-
-	ca.MaxNames = config.MaxNames
-
-	return ca, nil
+	return issuer.OCSPSigner.Sign(req)
 }
 
 func loadKey(keyConfig KeyConfig) (priv crypto.Signer, err error) {
@@ -200,6 +377,44 @@ func loadKey(keyConfig KeyConfig) (priv crypto.Signer, err error) {
 	return
 }
 
+// signatureAlgorithm returns the named signature algorithm, after checking
+// that it can be used with the issuer key. If no algorithm is named, it
+// returns SHA256WithRSA for RSA keys, and the ECDSA algorithm whose hash
+// matches the curve for P-256 and P-384 keys.
+func signatureAlgorithm(name string, priv crypto.Signer) (x509.SignatureAlgorithm, error) {
+	var keyType x509.PublicKeyAlgorithm
+	var defaultAlgorithm x509.SignatureAlgorithm
+	switch pub := priv.Public().(type) {
+	case *rsa.PublicKey:
+		keyType = x509.RSA
+		defaultAlgorithm = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		keyType = x509.ECDSA
+		switch pub.Curve {
+		case elliptic.P256():
+			defaultAlgorithm = x509.ECDSAWithSHA256
+		case elliptic.P384():
+			defaultAlgorithm = x509.ECDSAWithSHA384
+		default:
+			return x509.UnknownSignatureAlgorithm, errors.New("Issuer key must use curve P-256 or P-384")
+		}
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unsupported issuer key type %T", pub)
+	}
+
+	if name == "" {
+		return defaultAlgorithm, nil
+	}
+	alg, ok := signatureAlgorithms[name]
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unknown signature algorithm %s", name)
+	}
+	if alg.keyType != keyType {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("Signature algorithm %s cannot be used with the issuer key", name)
+	}
+	return alg.algorithm, nil
+}
+
 func loadIssuer(filename string) (issuerCert *x509.Certificate, err error) {
 	if filename == "" {
 		err = errors.New("Issuer certificate was not provided in config.")
@@ -243,7 +458,7 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(xferObj core.OCSPSigningRequest
 		RevokedAt:   xferObj.RevokedAt,
 	}
 
-	ocspResponse, err := ca.OCSPSigner.Sign(signRequest)
+	ocspResponse, err := ca.signOCSP(signRequest)
 	return ocspResponse, err
 }
 
@@ -268,7 +483,7 @@ func (ca *CertificateAuthorityImpl) RevokeCertificate(serial string, reasonCode
 		Reason:      reasonCode,
 		RevokedAt:   time.Now(),
 	}
-	ocspResponse, err := ca.OCSPSigner.Sign(signRequest)
+	ocspResponse, err := ca.signOCSP(signRequest)
 	if err != nil {
 		// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
 		ca.log.AuditErr(err)
@@ -303,14 +518,24 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return emptyCert, err
 	}
 
-	// Pull hostnames from CSR
+	// Pull hostnames and IP addresses from CSR, collapsing any duplicates.
 	// Authorization is checked by the RA
+	dnsNames, ipAddresses := core.CSRNames(&csr)
+	var identifiers []core.AcmeIdentifier
+	for _, name := range dnsNames {
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+	}
+	for _, ip := range ipAddresses {
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip.String()})
+	}
+	hostNames := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		hostNames[i] = identifier.Value
+	}
+
 	commonName := ""
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
 	if len(csr.Subject.CommonName) > 0 {
 		commonName = csr.Subject.CommonName
-		hostNames = append(hostNames, csr.Subject.CommonName)
 	} else if len(hostNames) > 0 {
 		commonName = hostNames[0]
 	} else {
@@ -320,44 +545,49 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return emptyCert, err
 	}
 
-	// Collapse any duplicate names.  Note that this operation may re-order the names
-	hostNames = core.UniqueNames(hostNames)
 	if ca.MaxNames > 0 && len(hostNames) > ca.MaxNames {
 		err = fmt.Errorf("Certificate request has %d > %d names", len(hostNames), ca.MaxNames)
 		ca.log.WarningErr(err)
 		return emptyCert, err
 	}
 
-	// Verify that names are allowed by policy
-	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: commonName}
-	if err = ca.PA.WillingToIssue(identifier); err != nil {
-		err = fmt.Errorf("Policy forbids issuing for name %s", commonName)
-		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
-		return emptyCert, err
-	}
-	for _, name := range hostNames {
-		identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+	// Verify that names are allowed by policy. The commonName is one of
+	// the identifiers, so checking them all covers it.
+	for _, identifier := range identifiers {
 		if err = ca.PA.WillingToIssue(identifier); err != nil {
-			err = fmt.Errorf("Policy forbids issuing for name %s", name)
+			err = fmt.Errorf("Policy forbids issuing for name %s", identifier.Value)
 			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 			ca.log.AuditErr(err)
 			return emptyCert, err
 		}
 	}
 
+	issuer, err := ca.chooseIssuer(csr.PublicKeyAlgorithm)
+	if err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err)
+		return emptyCert, err
+	}
+
 	notAfter := time.Now().Add(ca.ValidityPeriod)
 
-	if ca.NotAfter.Before(notAfter) {
+	if issuer.NotAfter.Before(notAfter) {
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		err = errors.New("Cannot issue a certificate that expires after the intermediate certificate.")
 		ca.log.AuditErr(err)
 		return emptyCert, err
 	}
 
-	// Note: We do not current enforce that certificate lifetimes match
-	// authorization lifetimes, because it was breaking integration tests.
+	// The signer sets notAfter from the profile's expiry, so a certificate
+	// that would outlive its shortest authorization can only be refused, not
+	// shortened.
 	if earliestExpiry.Before(notAfter) {
+		if ca.EnforceAuthzLifetime {
+			err = fmt.Errorf("Cannot issue a certificate that expires after the shortest underlying authorization. [%v] [%v]", earliestExpiry, notAfter)
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			ca.log.AuditErr(err)
+			return emptyCert, err
+		}
 		message := fmt.Sprintf("Issuing a certificate that expires after the shortest underlying authorization. [%v] [%v]", earliestExpiry, notAfter)
 		ca.log.Notice(message)
 	}
@@ -388,7 +618,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// Send the cert off for signing
 	req := signer.SignRequest{
 		Request: csrPEM,
-		Profile: ca.profile,
+		Profile: issuer.Profile,
 		Hosts:   hostNames,
 		Subject: &signer.Subject{
 			CN: commonName,
@@ -396,7 +626,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		SerialSeq: serialHex,
 	}
 
-	certPEM, err := ca.Signer.Sign(req)
+	certPEM, err := issuer.Signer.Sign(req)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		ca.log.Audit(fmt.Sprintf("Signer failed, rolling back: serial=[%s] err=[%v]", serialHex, err))
@@ -423,6 +653,19 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	}
 	certDER := block.Bytes
 
+	// Make sure the signer put every requested name, including wildcards,
+	// and every IP address into the subjectAltName extension
+	parsedCert, err := x509.ParseCertificate(certDER)
+	if err == nil {
+		err = checkHostNames(parsedCert, identifiers)
+	}
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.Audit(fmt.Sprintf("Issued certificate did not match request, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
+		tx.Rollback()
+		return emptyCert, err
+	}
+
 	cert := core.Certificate{
 		DER:    certDER,
 		Status: core.StatusValid,
@@ -468,7 +711,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		Status:      string(core.OCSPStatusGood),
 	}
 
-	ocspResponse, err := ca.OCSPSigner.Sign(signRequest)
+	ocspResponse, err := issuer.OCSPSigner.Sign(signRequest)
 	if err != nil {
 		ca.log.Warning(fmt.Sprintf("Post-Issuance OCSP failed signing: %s", err))
 		return cert, nil
@@ -484,3 +727,24 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// was issued. (Also, it should be impossible for err to be non-nil here)
 	return cert, nil
 }
+
+// checkHostNames verifies that each of the given identifiers appears in the
+// certificate's subjectAltName extension, as a dNSName or an iPAddress.
+func checkHostNames(cert *x509.Certificate, identifiers []core.AcmeIdentifier) error {
+	present := make(map[core.AcmeIdentifier]bool, len(cert.DNSNames)+len(cert.IPAddresses))
+	for _, name := range cert.DNSNames {
+		present[core.AcmeIdentifier{Type: core.IdentifierDNS, Value: strings.ToLower(name)}] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		present[core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip.String()}] = true
+	}
+	for _, identifier := range identifiers {
+		if identifier.Type == core.IdentifierDNS {
+			identifier.Value = strings.ToLower(identifier.Value)
+		}
+		if !present[identifier] {
+			return fmt.Errorf("Certificate is missing requested name %s", identifier.Value)
+		}
+	}
+	return nil
+}
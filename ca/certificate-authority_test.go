@@ -7,17 +7,29 @@ package ca
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
 	ocspConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp/config"
 	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
 	"github.com/letsencrypt/boulder/mocks"
 
 	"github.com/letsencrypt/boulder/core"
@@ -588,10 +600,16 @@ func TestRejectValidityTooLong(t *testing.T) {
 	_, err = ca.IssueCertificate(*csr, 1, FarPast)
 	test.Assert(t, err == nil, "Can issue a certificate that expires after the underlying authorization.")
 
+	// Unless authorization lifetimes are enforced
+	ca.EnforceAuthzLifetime = true
+	_, err = ca.IssueCertificate(*csr, 1, FarPast)
+	test.AssertError(t, err, "Issued a certificate that expires after the underlying authorization.")
+	ca.EnforceAuthzLifetime = false
+
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csrDER, _ = hex.DecodeString(NoCNCSRhex)
 	csr, _ = x509.ParseCertificateRequest(csrDER)
-	ca.NotAfter = time.Now()
+	ca.Issuers[0].NotAfter = time.Now()
 	_, err = ca.IssueCertificate(*csr, 1, FarFuture)
 	test.AssertEquals(t, err.Error(), "Cannot issue a certificate that expires after the intermediate certificate.")
 }
@@ -621,3 +639,184 @@ func TestRejectBadAlgorithm(t *testing.T) {
 	_, err = ca.IssueCertificate(*csr, 1, FarFuture)
 	test.Assert(t, err != nil, "Issued a certificate based on a CSR with a weak algorithm.")
 }
+
+func TestCheckHostNames(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"*.not-example.com", "www.not-example.com"},
+		IPAddresses: []net.IP{net.ParseIP("93.184.216.34")},
+	}
+	wildcard := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "*.not-example.com"}
+	www := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "WWW.not-example.com"}
+	ip := core.AcmeIdentifier{Type: core.IdentifierIP, Value: "93.184.216.34"}
+
+	err := checkHostNames(cert, []core.AcmeIdentifier{wildcard, www, ip})
+	test.AssertNotError(t, err, "Names present in certificate were rejected")
+
+	err = checkHostNames(cert, []core.AcmeIdentifier{wildcard, {Type: core.IdentifierDNS, Value: "not-example.com"}})
+	test.AssertError(t, err, "Name missing from certificate was accepted")
+
+	err = checkHostNames(cert, []core.AcmeIdentifier{{Type: core.IdentifierIP, Value: "93.184.216.35"}})
+	test.AssertError(t, err, "IP address missing from certificate was accepted")
+
+	err = checkHostNames(cert, []core.AcmeIdentifier{{Type: core.IdentifierDNS, Value: "93.184.216.34"}})
+	test.AssertError(t, err, "IP address was accepted as a DNS name")
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate RSA key")
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate P-256 key")
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate P-384 key")
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate P-521 key")
+
+	testCases := []struct {
+		name     string
+		key      crypto.Signer
+		expected x509.SignatureAlgorithm
+	}{
+		{"", rsaKey, x509.SHA256WithRSA},
+		{"", p256Key, x509.ECDSAWithSHA256},
+		{"", p384Key, x509.ECDSAWithSHA384},
+		{"SHA384WithRSA", rsaKey, x509.SHA384WithRSA},
+		{"ECDSAWithSHA256", p384Key, x509.ECDSAWithSHA256},
+	}
+	for _, tc := range testCases {
+		alg, err := signatureAlgorithm(tc.name, tc.key)
+		test.AssertNotError(t, err, fmt.Sprintf("Failed to choose algorithm %q", tc.name))
+		test.AssertEquals(t, alg, tc.expected)
+	}
+
+	_, err = signatureAlgorithm("", p521Key)
+	test.AssertError(t, err, "Accepted a P-521 issuer key")
+	_, err = signatureAlgorithm("ECDSAWithSHA384", rsaKey)
+	test.AssertError(t, err, "Accepted an ECDSA algorithm for an RSA key")
+	_, err = signatureAlgorithm("SHA256WithRSA", p384Key)
+	test.AssertError(t, err, "Accepted an RSA algorithm for an ECDSA key")
+	_, err = signatureAlgorithm("SHA1WithRSA", rsaKey)
+	test.AssertError(t, err, "Accepted SHA-1")
+}
+
+// writeECDSAIssuer writes a fresh self-signed P-384 issuer key and
+// certificate into dir, and returns their paths.
+func writeECDSAIssuer(t *testing.T, dir string) (keyFile, certFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "P-384 intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Failed to create issuer cert")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.AssertNotError(t, err, "Failed to marshal issuer key")
+
+	keyFile = filepath.Join(dir, "issuer.key")
+	certFile = filepath.Join(dir, "issuer.pem")
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	test.AssertNotError(t, err, "Failed to write issuer key")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
+	test.AssertNotError(t, err, "Failed to write issuer cert")
+	return
+}
+
+func TestMultipleIssuers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ca-issuers")
+	test.AssertNotError(t, err, "Failed to make temp dir")
+	defer os.RemoveAll(dir)
+	ecdsaKeyFile, ecdsaCertFile := writeECDSAIssuer(t, dir)
+
+	cadb, storageAuthority, caConfig := setup(t)
+	caConfig.Issuers = []IssuerConfig{
+		IssuerConfig{Key: KeyConfig{File: caKeyFile}, CertFile: caCertFile, Active: true},
+		IssuerConfig{Key: KeyConfig{File: ecdsaKeyFile}, CertFile: ecdsaCertFile, Active: true},
+	}
+	ca, err := NewCertificateAuthorityImpl(cadb, caConfig, "")
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.SA = storageAuthority
+	ca.MaxKeySize = 4096
+	test.AssertEquals(t, len(ca.Issuers), 2)
+	test.AssertEquals(t, ca.Issuers[1].Profile, profileName)
+
+	// An ECDSA CSR is signed by the ECDSA issuer
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "ecdsa.letsencrypt.org"},
+		DNSNames: []string{"ecdsa.letsencrypt.org"},
+	}, certKey)
+	test.AssertNotError(t, err, "Failed to create CSR")
+	csr, _ := x509.ParseCertificateRequest(csrDER)
+	issued, err := ca.IssueCertificate(*csr, 1, FarFuture)
+	test.AssertNotError(t, err, "Failed to issue certificate")
+	cert, err := x509.ParseCertificate(issued.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.AssertEquals(t, cert.SignatureAlgorithm, x509.ECDSAWithSHA384)
+	test.AssertNotError(t, cert.CheckSignatureFrom(ca.Issuers[1].Cert), "Certificate not signed by ECDSA issuer")
+
+	// OCSP responses come from the issuer that signed the certificate, even
+	// after it has been made inactive
+	ca.Issuers[1].Active = false
+	responseDER, err := ca.GenerateOCSP(core.OCSPSigningRequest{
+		CertDER: issued.DER,
+		Status:  string(core.OCSPStatusGood),
+	})
+	test.AssertNotError(t, err, "Failed to sign OCSP response")
+	response, err := ocsp.ParseResponse(responseDER, ca.Issuers[1].Cert)
+	test.AssertNotError(t, err, "Failed to parse OCSP response")
+	test.AssertEquals(t, response.SerialNumber.Cmp(cert.SerialNumber), 0)
+
+	// With no active issuer, nothing can be issued
+	ca.Issuers[0].Active = false
+	_, err = ca.IssueCertificate(*csr, 1, FarFuture)
+	test.AssertError(t, err, "Issued a certificate with no active issuer")
+
+	// A CA needs at least one active issuer
+	caConfig.Issuers[0].Active = false
+	caConfig.Issuers[1].Active = false
+	_, err = NewCertificateAuthorityImpl(cadb, caConfig, "")
+	test.AssertError(t, err, "Created a CA with no active issuer")
+
+	// An issuer's key must match its certificate
+	caConfig.Issuers = []IssuerConfig{
+		IssuerConfig{Key: KeyConfig{File: ecdsaKeyFile}, CertFile: caCertFile, Active: true},
+	}
+	_, err = NewCertificateAuthorityImpl(cadb, caConfig, "")
+	test.AssertError(t, err, "Created a CA with a mismatched issuer key")
+}
+
+func TestChooseIssuer(t *testing.T) {
+	rsaA := &Issuer{Cert: &x509.Certificate{PublicKeyAlgorithm: x509.RSA}, Active: true, Weight: 3}
+	rsaB := &Issuer{Cert: &x509.Certificate{PublicKeyAlgorithm: x509.RSA}, Active: true}
+	rsaOld := &Issuer{Cert: &x509.Certificate{PublicKeyAlgorithm: x509.RSA}, Active: false, Weight: 10}
+	ca := &CertificateAuthorityImpl{Issuers: []*Issuer{rsaOld, rsaA, rsaB}}
+
+	// RSA requests rotate between the active RSA issuers in a 3:1 ratio
+	counts := make(map[*Issuer]int)
+	for i := 0; i < 8; i++ {
+		issuer, err := ca.chooseIssuer(x509.RSA)
+		test.AssertNotError(t, err, "Failed to choose issuer")
+		counts[issuer]++
+	}
+	test.AssertEquals(t, counts[rsaA], 6)
+	test.AssertEquals(t, counts[rsaB], 2)
+	test.AssertEquals(t, counts[rsaOld], 0)
+
+	// With no ECDSA issuer, ECDSA requests fall back to the active issuers
+	issuer, err := ca.chooseIssuer(x509.ECDSA)
+	test.AssertNotError(t, err, "Failed to choose issuer for ECDSA key")
+	test.Assert(t, issuer == rsaA || issuer == rsaB, "Chose an inactive issuer")
+
+	// An active issuer with the same key type is preferred
+	ecdsaIssuer := &Issuer{Cert: &x509.Certificate{PublicKeyAlgorithm: x509.ECDSA}, Active: true}
+	ca.Issuers = append(ca.Issuers, ecdsaIssuer)
+	issuer, err = ca.chooseIssuer(x509.ECDSA)
+	test.AssertNotError(t, err, "Failed to choose issuer for ECDSA key")
+	test.Assert(t, issuer == ecdsaIssuer, "Did not choose the ECDSA issuer")
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	cferr "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/errors"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+)
+
+var ocspStatusCodes = map[string]int{
+	"good":    ocsp.Good,
+	"revoked": ocsp.Revoked,
+	"unknown": ocsp.Unknown,
+}
+
+// ocspSigner signs OCSP responses with the issuer key. It works like CFSSL's
+// StandardSigner, which always picks the default signature algorithm for
+// the key, except that it signs with the algorithm the CA uses for
+// certificates.
+type ocspSigner struct {
+	issuer    *x509.Certificate
+	key       crypto.Signer
+	algorithm x509.SignatureAlgorithm
+	interval  time.Duration
+}
+
+// Sign produces an OCSP response for a certificate issued by the signer's
+// issuer.
+func (s *ocspSigner) Sign(req cfocsp.SignRequest) ([]byte, error) {
+	if req.Certificate == nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.ReadFailed)
+	}
+
+	// Verify that req.Certificate is issued under s.issuer
+	if !bytes.Equal(req.Certificate.RawIssuer, s.issuer.RawSubject) {
+		return nil, cferr.New(cferr.OCSPError, cferr.IssuerMismatch)
+	}
+	if req.Certificate.CheckSignatureFrom(s.issuer) != nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.IssuerMismatch)
+	}
+
+	status, ok := ocspStatusCodes[req.Status]
+	if !ok {
+		return nil, cferr.New(cferr.OCSPError, cferr.InvalidStatus)
+	}
+
+	// Round thisUpdate times to the nearest hour
+	thisUpdate := time.Now().Round(time.Hour)
+
+	template := ocsp.Response{
+		Status:             status,
+		SerialNumber:       req.Certificate.SerialNumber,
+		ThisUpdate:         thisUpdate,
+		NextUpdate:         thisUpdate.Add(s.interval),
+		Certificate:        s.issuer,
+		SignatureAlgorithm: s.algorithm,
+	}
+	if status == ocsp.Revoked {
+		template.RevokedAt = req.RevokedAt
+		template.RevocationReason = req.Reason
+	}
+
+	return ocsp.CreateResponse(s.issuer, s.issuer, template, s.key)
+}
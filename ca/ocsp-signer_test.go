@@ -0,0 +1,87 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestOCSPSignerECDSA(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "P-384 intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SignatureAlgorithm:    x509.ECDSAWithSHA384,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create issuer cert")
+	issuer, _ := x509.ParseCertificate(issuerDER)
+
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTemplate := &x509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		Subject:            pkix.Name{CommonName: "example.com"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: x509.ECDSAWithSHA384,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuer, &leafKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create leaf cert")
+	leaf, _ := x509.ParseCertificate(leafDER)
+
+	algorithm, err := signatureAlgorithm("", issuerKey)
+	test.AssertNotError(t, err, "Failed to choose signature algorithm")
+	signer := &ocspSigner{
+		issuer:    issuer,
+		key:       issuerKey,
+		algorithm: algorithm,
+		interval:  time.Hour,
+	}
+
+	responseDER, err := signer.Sign(cfocsp.SignRequest{
+		Certificate: leaf,
+		Status:      "revoked",
+		Reason:      1,
+		RevokedAt:   time.Now(),
+	})
+	test.AssertNotError(t, err, "Failed to sign OCSP response")
+	response, err := ocsp.ParseResponse(responseDER, issuer)
+	test.AssertNotError(t, err, "Failed to parse OCSP response")
+	test.AssertEquals(t, response.SignatureAlgorithm, x509.ECDSAWithSHA384)
+	test.AssertEquals(t, response.Status, ocsp.Revoked)
+	test.AssertEquals(t, response.SerialNumber.Cmp(leaf.SerialNumber), 0)
+
+	_, err = signer.Sign(cfocsp.SignRequest{Certificate: leaf, Status: "fine"})
+	test.AssertError(t, err, "Signed a response with an unknown status")
+
+	// A certificate from another issuer with the same name is refused
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	otherIssuerDER, _ := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &otherKey.PublicKey, otherKey)
+	otherIssuer, _ := x509.ParseCertificate(otherIssuerDER)
+	otherDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, otherIssuer, &leafKey.PublicKey, otherKey)
+	test.AssertNotError(t, err, "Failed to create leaf cert from other issuer")
+	other, _ := x509.ParseCertificate(otherDER)
+	_, err = signer.Sign(cfocsp.SignRequest{Certificate: other, Status: "good"})
+	test.AssertError(t, err, "Signed a response for a certificate from another issuer")
+}
@@ -31,20 +31,6 @@ import (
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 )
 
-var reasons = map[int]string{
-	0: "unspecified",
-	1: "keyCompromise",
-	2: "cACompromise",
-	3: "affiliationChanged",
-	4: "superseded",
-	5: "cessationOfOperation",
-	6: "certificateHold",
-	// 7 is unused
-	8:  "removeFromCRL", // needed?
-	9:  "privilegeWithdrawn",
-	10: "aAcompromise",
-}
-
 func loadConfig(c *cli.Context) (config cmd.Config, err error) {
 	configFileName := c.GlobalString("config")
 	configJSON, err := ioutil.ReadFile(configFileName)
@@ -91,7 +77,7 @@ func addDeniedNames(tx *gorp.Transaction, names []string) (err error) {
 }
 
 func revokeBySerial(serial string, reasonCode int, deny bool, cac rpc.CertificateAuthorityClient, auditlogger *blog.AuditLogger, tx *gorp.Transaction) (err error) {
-	if reasonCode < 0 || reasonCode == 7 || reasonCode > 10 {
+	if _, ok := core.RevocationReasons[reasonCode]; !ok {
 		panic(fmt.Sprintf("Invalid reason code: %d", reasonCode))
 	}
 
@@ -122,7 +108,7 @@ func revokeBySerial(serial string, reasonCode int, deny bool, cac rpc.Certificat
 		return
 	}
 
-	auditlogger.Info(fmt.Sprintf("Revoked certificate %s with reason '%s'", serial, reasons[reasonCode]))
+	auditlogger.Info(fmt.Sprintf("Revoked certificate %s with reason '%s'", serial, core.RevocationReasons[reasonCode]))
 	return
 }
 
@@ -232,13 +218,13 @@ func main() {
 			Usage: "List all revocation reason codes",
 			Action: func(c *cli.Context) {
 				var codes []int
-				for k := range reasons {
+				for k := range core.RevocationReasons {
 					codes = append(codes, k)
 				}
 				sort.Ints(codes)
 				fmt.Printf("Revocation reason codes\n-----------------------\n\n")
 				for _, k := range codes {
-					fmt.Printf("%d: %s\n", k, reasons[k])
+					fmt.Printf("%d: %s\n", k, core.RevocationReasons[k])
 				}
 			},
 		},
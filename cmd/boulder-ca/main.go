@@ -44,6 +44,7 @@ func main() {
 		cai, err := ca.NewCertificateAuthorityImpl(cadb, c.CA, c.Common.IssuerCert)
 		cmd.FailOnError(err, "Failed to create CA impl")
 		cai.MaxKeySize = c.Common.MaxKeySize
+		cai.PA = cmd.NewPolicyAuthority(c)
 
 		go cmd.ProfileCmd("CA", stats)
 
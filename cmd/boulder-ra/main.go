@@ -37,11 +37,29 @@ func main() {
 		go cmd.DebugServer(c.RA.DebugAddr)
 
 		rai := ra.NewRegistrationAuthorityImpl()
+		rai.PA = cmd.NewPolicyAuthority(c)
 		rai.AuthzBase = c.Common.BaseURL + wfe.AuthzPath
 		rai.MaxKeySize = c.Common.MaxKeySize
 		raDNSTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse RA DNS timeout")
 		rai.DNSResolver = core.NewDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver})
+		if c.RA.PendingAuthorizationLifetime != "" {
+			rai.PendingAuthorizationLifetime, err = time.ParseDuration(c.RA.PendingAuthorizationLifetime)
+			cmd.FailOnError(err, "Couldn't parse pending authorization lifetime")
+		}
+		if c.RA.AuthorizationLifetime != "" {
+			rai.AuthorizationLifetime, err = time.ParseDuration(c.RA.AuthorizationLifetime)
+			cmd.FailOnError(err, "Couldn't parse authorization lifetime")
+		}
+		rai.ReuseAuthorizations = c.RA.ReuseAuthorizations
+		if c.RA.AuthorizationReuseMinLifetime != "" {
+			rai.ReuseMinLifetime, err = time.ParseDuration(c.RA.AuthorizationReuseMinLifetime)
+			cmd.FailOnError(err, "Couldn't parse authorization reuse minimum lifetime")
+		}
+		if c.RA.RateLimitPoliciesFilename != "" {
+			rai.RateLimitPolicies, err = ra.LoadRateLimitPolicies(c.RA.RateLimitPoliciesFilename)
+			cmd.FailOnError(err, "Couldn't load rate limit policies")
+		}
 
 		go cmd.ProfileCmd("RA", stats)
 
@@ -42,6 +42,7 @@ func main() {
 		cmd.FailOnError(err, "Couldn't parse DNS timeout")
 		vai.DNSResolver = core.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
 		vai.UserAgent = c.VA.UserAgent
+		vai.IssuerDomain = c.VA.IssuerDomain
 
 		for {
 			ch, err := cmd.AmqpChannel(c)
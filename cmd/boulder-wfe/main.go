@@ -105,9 +105,20 @@ func main() {
 		cmd.FailOnError(err, "Couldn't parse index caching duration")
 		wfe.IssuerCacheDuration, err = time.ParseDuration(c.WFE.IssuerCacheDuration)
 		cmd.FailOnError(err, "Couldn't parse issuer caching duration")
+		wfe.AllowOrigins = c.WFE.AllowOrigins
+		wfe.Website = c.WFE.Website
+		wfe.ExternalAccountRequired = c.WFE.ExternalAccountRequired
+		if c.VA.IssuerDomain != "" {
+			wfe.CAAIdentities = []string{c.VA.IssuerDomain}
+		}
 
 		wfe.IssuerCert, err = cmd.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", c.Common.IssuerCert))
+		for _, issuer := range c.CA.Issuers {
+			issuerCert, err := cmd.LoadCert(issuer.CertFile)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", issuer.CertFile))
+			wfe.IssuerCerts = append(wfe.IssuerCerts, issuerCert)
+		}
 
 		go cmd.ProfileCmd("WFE", stats)
 
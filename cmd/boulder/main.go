@@ -90,24 +90,55 @@ func main() {
 		cmd.FailOnError(err, "Couldn't parse index caching duration")
 		wfei.IssuerCacheDuration, err = time.ParseDuration(c.WFE.IssuerCacheDuration)
 		cmd.FailOnError(err, "Couldn't parse issuer caching duration")
+		wfei.AllowOrigins = c.WFE.AllowOrigins
+		wfei.Website = c.WFE.Website
+		wfei.ExternalAccountRequired = c.WFE.ExternalAccountRequired
+		if c.VA.IssuerDomain != "" {
+			wfei.CAAIdentities = []string{c.VA.IssuerDomain}
+		}
 
 		dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse DNS timeout")
 		dnsResolver := core.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver})
 
+		pa := cmd.NewPolicyAuthority(c)
+
+		var rateLimitPolicies ra.RateLimitPolicies
+		if c.RA.RateLimitPoliciesFilename != "" {
+			rateLimitPolicies, err = ra.LoadRateLimitPolicies(c.RA.RateLimitPoliciesFilename)
+			cmd.FailOnError(err, "Couldn't load rate limit policies")
+		}
+
 		ra := ra.NewRegistrationAuthorityImpl()
 		cmd.FailOnError(err, "Couldn't parse RA DNS timeout")
 		ra.DNSResolver = dnsResolver
+		ra.PA = pa
+		ra.RateLimitPolicies = rateLimitPolicies
+		if c.RA.PendingAuthorizationLifetime != "" {
+			ra.PendingAuthorizationLifetime, err = time.ParseDuration(c.RA.PendingAuthorizationLifetime)
+			cmd.FailOnError(err, "Couldn't parse pending authorization lifetime")
+		}
+		if c.RA.AuthorizationLifetime != "" {
+			ra.AuthorizationLifetime, err = time.ParseDuration(c.RA.AuthorizationLifetime)
+			cmd.FailOnError(err, "Couldn't parse authorization lifetime")
+		}
+		ra.ReuseAuthorizations = c.RA.ReuseAuthorizations
+		if c.RA.AuthorizationReuseMinLifetime != "" {
+			ra.ReuseMinLifetime, err = time.ParseDuration(c.RA.AuthorizationReuseMinLifetime)
+			cmd.FailOnError(err, "Couldn't parse authorization reuse minimum lifetime")
+		}
 
 		va := va.NewValidationAuthorityImpl(c.CA.TestMode)
 		va.DNSResolver = dnsResolver
 		va.UserAgent = c.VA.UserAgent
+		va.IssuerDomain = c.VA.IssuerDomain
 
 		cadb, err := ca.NewCertificateAuthorityDatabaseImpl(c.CA.DBDriver, c.CA.DBConnect)
 		cmd.FailOnError(err, "Failed to create CA database")
 
 		ca, err := ca.NewCertificateAuthorityImpl(cadb, c.CA, c.Common.IssuerCert)
 		cmd.FailOnError(err, "Unable to create CA")
+		ca.PA = pa
 
 		if c.SQL.CreateTables {
 			err = sa.CreateTablesIfNotExists()
@@ -125,6 +156,11 @@ func main() {
 
 		wfei.IssuerCert, err = cmd.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", c.Common.IssuerCert))
+		for _, issuer := range c.CA.Issuers {
+			issuerCert, err := cmd.LoadCert(issuer.CertFile)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", issuer.CertFile))
+			wfei.IssuerCerts = append(wfei.IssuerCerts, issuerCert)
+		}
 
 		ra.CA = ca
 		ra.SA = sa
@@ -44,6 +44,7 @@ import (
 	"github.com/letsencrypt/boulder/ca"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/policy"
 	"github.com/letsencrypt/boulder/rpc"
 )
 
@@ -78,6 +79,15 @@ type Config struct {
 		IndexCacheDuration          string
 		IssuerCacheDuration         string
 
+		// AllowOrigins lists the origins browser-based clients may make
+		// cross-origin requests from. "*" or an empty list allows any origin.
+		AllowOrigins []string
+
+		// Website and ExternalAccountRequired are advertised in the
+		// directory's meta object.
+		Website                 string
+		ExternalAccountRequired bool
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -89,7 +99,40 @@ type Config struct {
 		DebugAddr string
 	}
 
+	PA struct {
+		// IDN configures which internationalized domain names the policy
+		// authority accepts.
+		IDN policy.IDNPolicy
+
+		// HighRiskDomains lists domains whose names, and the names under
+		// them, must be validated through DNS as well as another challenge.
+		HighRiskDomains []string
+
+		// ChallengeRulesFilename is the path to a JSON file of rules for
+		// choosing the challenges offered for each identifier. It is
+		// reloaded when it changes, so that challenge types can be disabled
+		// without a restart.
+		ChallengeRulesFilename string
+	}
+
 	RA struct {
+		// RateLimitPoliciesFilename is the path to a JSON file of
+		// certificate issuance rate limits. Without one, issuance is not
+		// rate limited.
+		RateLimitPoliciesFilename string
+
+		// PendingAuthorizationLifetime and AuthorizationLifetime are how
+		// long authorizations remain pending and, once validated, valid,
+		// e.g. "168h" and "720h". Empty values keep the defaults.
+		PendingAuthorizationLifetime string
+		AuthorizationLifetime        string
+
+		// ReuseAuthorizations makes new-authz return an existing pending or
+		// valid authorization for the same registration and identifier,
+		// if it remains usable for at least AuthorizationReuseMinLifetime.
+		ReuseAuthorizations           bool
+		AuthorizationReuseMinLifetime string
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -105,6 +148,10 @@ type Config struct {
 	VA struct {
 		UserAgent string
 
+		// IssuerDomain is the domain CAA records must name for this CA to
+		// issue. It is also advertised in the directory's caa-identities.
+		IssuerDomain string
+
 		// DebugAddr is the address to run the /debug handlers on.
 		DebugAddr string
 	}
@@ -193,6 +240,25 @@ type Queue struct {
 	Server string
 }
 
+// How often the challenge rules file is checked for changes
+const challengeRulesReloadInterval = 30 * time.Second
+
+// NewPolicyAuthority constructs a policy authority from the configuration.
+func NewPolicyAuthority(c Config) *policy.PolicyAuthorityImpl {
+	pa := policy.NewPolicyAuthorityImpl()
+	pa.IDN = c.PA.IDN
+	pa.HighRisk = make(map[string]bool)
+	for _, domain := range c.PA.HighRiskDomains {
+		pa.HighRisk[strings.ToLower(domain)] = true
+	}
+	if c.PA.ChallengeRulesFilename != "" {
+		err := pa.LoadChallengeRules(c.PA.ChallengeRulesFilename)
+		FailOnError(err, "Couldn't load challenge rules")
+		go pa.WatchChallengeRules(c.PA.ChallengeRulesFilename, challengeRulesReloadInterval)
+	}
+	return pa
+}
+
 // AppShell contains CLI Metadata
 type AppShell struct {
 	Action func(Config)
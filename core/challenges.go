@@ -5,6 +5,10 @@
 
 package core
 
+import (
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+)
+
 // SimpleHTTPChallenge constructs a random HTTP challenge
 func SimpleHTTPChallenge() Challenge {
 	tls := true
@@ -16,6 +20,15 @@ func SimpleHTTPChallenge() Challenge {
 	}
 }
 
+// HTTPChallenge01 constructs a random http-01 challenge
+func HTTPChallenge01() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeHTTP01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
 // DvsniChallenge constructs a random DVSNI challenge
 func DvsniChallenge() Challenge {
 	return Challenge{
@@ -33,3 +46,31 @@ func DNSChallenge() Challenge {
 		Token:  NewToken(),
 	}
 }
+
+// DNSChallenge01 constructs a random dns-01 challenge
+func DNSChallenge01() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeDNS01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
+// TLSALPNChallenge01 constructs a random tls-alpn-01 challenge
+func TLSALPNChallenge01() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeTLSALPN01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
+// NewKeyAuthorization returns the key authorization for a challenge token
+// and account key: the token and the key's thumbprint, joined by a period.
+func NewKeyAuthorization(token string, accountKey *jose.JsonWebKey) (string, error) {
+	thumbprint, err := Thumbprint(accountKey)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
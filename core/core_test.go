@@ -26,6 +26,30 @@ func TestChallenges(t *testing.T) {
 		t.Errorf("Incorrect length for simpleHTTP token: %v", simpleHTTP.Token)
 	}
 
+	http01 := HTTPChallenge01()
+	if http01.Status != StatusPending || http01.Type != ChallengeTypeHTTP01 {
+		t.Errorf("Incorrect http-01 challenge: %v", http01)
+	}
+	if !http01.IsSane(false) {
+		t.Errorf("New http-01 challenge is not sane: %v", http01)
+	}
+
+	dns01 := DNSChallenge01()
+	if dns01.Status != StatusPending || dns01.Type != ChallengeTypeDNS01 {
+		t.Errorf("Incorrect dns-01 challenge: %v", dns01)
+	}
+	if !dns01.IsSane(false) {
+		t.Errorf("New dns-01 challenge is not sane: %v", dns01)
+	}
+
+	tlsALPN01 := TLSALPNChallenge01()
+	if tlsALPN01.Status != StatusPending || tlsALPN01.Type != ChallengeTypeTLSALPN01 {
+		t.Errorf("Incorrect tls-alpn-01 challenge: %v", tlsALPN01)
+	}
+	if !tlsALPN01.IsSane(false) {
+		t.Errorf("New tls-alpn-01 challenge is not sane: %v", tlsALPN01)
+	}
+
 	dvsni := DvsniChallenge()
 	if dvsni.Status != StatusPending {
 		t.Errorf("Incorrect status for challenge: %v", dvsni.Status)
@@ -109,6 +133,25 @@ func TestMergeChallenge(t *testing.T) {
 	}
 }
 
+func TestMergeKeyAuthorizationChallenge(t *testing.T) {
+	for _, challenge := range []Challenge{HTTPChallenge01(), DNSChallenge01(), TLSALPNChallenge01()} {
+		response := Challenge{
+			Type:             ChallengeTypeSimpleHTTP,
+			Status:           StatusValid,
+			Token:            "forged",
+			KeyAuthorization: challenge.Token + ".thumbprint",
+		}
+
+		merged := challenge.MergeResponse(response)
+		if merged.KeyAuthorization != response.KeyAuthorization {
+			t.Errorf("Key authorization was not merged: %v", merged)
+		}
+		if merged.Type != challenge.Type || merged.Status != StatusPending || merged.Token != challenge.Token {
+			t.Errorf("Server-provided fields were overwritten: %v", merged)
+		}
+	}
+}
+
 // util.go
 
 func TestErrors(t *testing.T) {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
@@ -54,9 +55,10 @@ func (dnsResolver *DNSResolverImpl) ExchangeOne(hostname string, qtype uint16) (
 }
 
 // LookupTXT sends a DNS query to find all TXT records associated with
-// the provided hostname.
+// the provided hostname. It returns every string of every record, followed by
+// the concatenated value of each record made up of several strings.
 func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) ([]string, time.Duration, error) {
-	var txt []string
+	var txt, joined []string
 	r, rtt, err := dnsResolver.ExchangeOne(hostname, dns.TypeTXT)
 	if err != nil {
 		return nil, 0, err
@@ -72,11 +74,14 @@ func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) ([]string, time.D
 				for _, field := range txtRec.Txt {
 					txt = append(txt, field)
 				}
+				if len(txtRec.Txt) > 1 {
+					joined = append(joined, strings.Join(txtRec.Txt, ""))
+				}
 			}
 		}
 	}
 
-	return txt, rtt, err
+	return append(txt, joined...), rtt, err
 }
 
 // LookupHost sends a DNS query to find all A/AAAA records associated with
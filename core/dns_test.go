@@ -74,6 +74,17 @@ func mockDNSQuery(w dns.ResponseWriter, r *dns.Msg) {
 				record.Target = "cps.letsencrypt.org."
 				appendAnswer(record)
 			}
+		case dns.TypeTXT:
+			if q.Name == "split-txt.letsencrypt.org." {
+				record := new(dns.TXT)
+				record.Hdr = dns.RR_Header{Name: "split-txt.letsencrypt.org.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 0}
+				record.Txt = []string{"a", "b", "c"}
+				appendAnswer(record)
+				record = new(dns.TXT)
+				record.Hdr = dns.RR_Header{Name: "split-txt.letsencrypt.org.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 0}
+				record.Txt = []string{"d"}
+				appendAnswer(record)
+			}
 		case dns.TypeCAA:
 			if q.Name == "bracewel.net." || q.Name == "caa.example.com." {
 				record := new(dns.CAA)
@@ -196,6 +207,11 @@ func TestDNSLookupTXT(t *testing.T) {
 
 	t.Logf("A: %v RTT %s", a, rtt)
 	test.AssertNotError(t, err, "No message")
+
+	// Records split into several strings are also returned joined
+	txts, _, err := obj.LookupTXT("split-txt.letsencrypt.org")
+	test.AssertNotError(t, err, "No message")
+	test.AssertEquals(t, strings.Join(txts, ","), "a,b,c,d,abc")
 }
 
 func TestDNSLookupHost(t *testing.T) {
@@ -8,6 +8,7 @@ package core
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"fmt"
 	blog "github.com/letsencrypt/boulder/log"
@@ -63,9 +64,45 @@ func GoodKey(key crypto.PublicKey, maxKeySize int) error {
 // GoodKeyECDSA determines if an ECDSA pubkey meets our requirements
 func GoodKeyECDSA(key ecdsa.PublicKey, maxKeySize int) (err error) {
 	log := blog.GetAuditLogger()
-	err = NotSupportedError("ECDSA keys not yet supported")
-	log.Debug(err.Error())
-	return
+	// Baseline Requirements Appendix A
+	// Only NIST P-256 and P-384 are allowed
+	if key.Curve != elliptic.P256() && key.Curve != elliptic.P384() {
+		err = MalformedRequestError("ECDSA curve not allowed, must be P-256 or P-384")
+		log.Debug(err.Error())
+		return err
+	}
+
+	// The remaining checks are the partial public key validation routine
+	// from NIST SP 800-56A, section 5.6.2.3.3.
+	//
+	// 1. Verify that Q is not the point at infinity. crypto/elliptic
+	// represents it as (0, 0).
+	x, y := key.X, key.Y
+	if x == nil || y == nil || (x.Sign() == 0 && y.Sign() == 0) {
+		err = MalformedRequestError("Key must not be the point at infinity")
+		log.Debug(err.Error())
+		return err
+	}
+
+	// 2. Verify that x and y are integers in the interval [0, p-1].
+	p := key.Curve.Params().P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 {
+		err = MalformedRequestError("Key coordinates must be in the range [0, p-1]")
+		log.Debug(err.Error())
+		return err
+	}
+
+	// 3. Verify that y^2 = x^3 + ax + b (mod p), i.e. Q is on the curve.
+	if !key.Curve.IsOnCurve(x, y) {
+		err = MalformedRequestError("Key point is not on the curve")
+		log.Debug(err.Error())
+		return err
+	}
+
+	// The full validation routine also checks that nQ is the point at
+	// infinity. P-256 and P-384 have cofactor 1, so this holds for every
+	// point that passed the checks above.
+	return nil
 }
 
 // GoodKeyRSA determines if a RSA pubkey meets our requirements
@@ -7,6 +7,7 @@ package core
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"math/big"
@@ -28,6 +29,45 @@ func TestWrongKeyType(t *testing.T) {
 	test.AssertError(t, GoodKey(ecdsaKey, maxKeySize), "Should have rejected ECDSA key.")
 }
 
+func TestGoodKeyECDSA(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		test.AssertNotError(t, err, "Error generating key")
+		test.AssertNotError(t, GoodKey(&private.PublicKey, maxKeySize), "Should have accepted ECDSA key")
+		test.AssertNotError(t, GoodKey(private.PublicKey, maxKeySize), "Should have accepted ECDSA key")
+	}
+}
+
+func TestECDSABadCurve(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P521()} {
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		test.AssertNotError(t, err, "Error generating key")
+		test.AssertError(t, GoodKey(&private.PublicKey, maxKeySize), "Should have rejected key on disallowed curve")
+	}
+}
+
+func TestECDSABadPoint(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	curve := private.Curve
+	x, y := private.X, private.Y
+
+	identity := ecdsa.PublicKey{Curve: curve, X: big.NewInt(0), Y: big.NewInt(0)}
+	test.AssertError(t, GoodKey(&identity, maxKeySize), "Should have rejected the point at infinity")
+
+	missing := ecdsa.PublicKey{Curve: curve, X: x}
+	test.AssertError(t, GoodKey(&missing, maxKeySize), "Should have rejected key with missing coordinate")
+
+	offCurve := ecdsa.PublicKey{Curve: curve, X: x, Y: new(big.Int).Add(y, big.NewInt(1))}
+	test.AssertError(t, GoodKey(&offCurve, maxKeySize), "Should have rejected point not on the curve")
+
+	outOfRange := ecdsa.PublicKey{Curve: curve, X: new(big.Int).Add(x, curve.Params().P), Y: y}
+	test.AssertError(t, GoodKey(&outOfRange, maxKeySize), "Should have rejected coordinate >= p")
+
+	negative := ecdsa.PublicKey{Curve: curve, X: x, Y: new(big.Int).Neg(y)}
+	test.AssertError(t, GoodKey(&negative, maxKeySize), "Should have rejected negative coordinate")
+}
+
 func TestSmallModulus(t *testing.T) {
 	private, err := rsa.GenerateKey(rand.Reader, 2040)
 	test.AssertNotError(t, err, "Error generating key")
@@ -64,14 +64,29 @@ type RegistrationAuthority interface {
 	// [WebFrontEnd]
 	NewCertificate(CertificateRequest, int64) (Certificate, error)
 
+	// [WebFrontEnd]
+	NewOrder(Order, int64) (Order, error)
+
+	// [WebFrontEnd]
+	FinalizeOrder(Order, CertificateRequest, int64) (Order, error)
+
 	// [WebFrontEnd]
 	UpdateRegistration(Registration, Registration) (Registration, error)
 
+	// [WebFrontEnd]
+	ChangeRegistrationKey(Registration, jose.JsonWebKey) (Registration, error)
+
+	// [WebFrontEnd]
+	DeactivateRegistration(Registration) (Registration, error)
+
 	// [WebFrontEnd]
 	UpdateAuthorization(Authorization, int, Challenge) (Authorization, error)
 
 	// [WebFrontEnd]
-	RevokeCertificate(x509.Certificate) error
+	DeactivateAuthorization(Authorization) (Authorization, error)
+
+	// [WebFrontEnd]
+	RevokeCertificate(x509.Certificate, int) error
 
 	// [ValidationAuthority]
 	OnValidationUpdate(Authorization) error
@@ -95,7 +110,8 @@ type CertificateAuthority interface {
 // PolicyAuthority defines the public interface for the Boulder PA
 type PolicyAuthority interface {
 	WillingToIssue(AcmeIdentifier) error
-	ChallengesFor(AcmeIdentifier) ([]Challenge, [][]int)
+	ChallengesFor(AcmeIdentifier, int64) ([]Challenge, [][]int)
+	ChallengeTypeEnabled(string) bool
 }
 
 // StorageGetter are the Boulder SA's read-only methods
@@ -104,23 +120,40 @@ type StorageGetter interface {
 	GetRegistrationByKey(jose.JsonWebKey) (Registration, error)
 	GetAuthorization(string) (Authorization, error)
 	GetLatestValidAuthorization(int64, AcmeIdentifier) (Authorization, error)
+	GetAuthorizationsByIdentifier(int64, AcmeIdentifier, time.Time) ([]Authorization, error)
+	GetAuthorizationsByRegistration(regID int64, offset, limit int) ([]Authorization, error)
 	GetCertificate(string) (Certificate, error)
 	GetCertificateByShortSerial(string) (Certificate, error)
 	GetCertificateStatus(string) (CertificateStatus, error)
+	GetCertificatesByRegistration(regID int64, offset, limit int) ([]Certificate, error)
+	GetOrder(string) (Order, error)
+	GetPendingOrders(int64) ([]Order, error)
 	AlreadyDeniedCSR([]string) (bool, error)
+	CountCertificatesByNames(domains []string, earliest, latest time.Time) (map[string]int, error)
+	CountFQDNSets(window time.Duration, names []string) (int64, error)
+	CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (int, error)
+	CountPendingAuthorizations(regID int64) (int, error)
+	CountInvalidAuthorizations(regID int64, identifier AcmeIdentifier, earliest, latest time.Time) (int, error)
 }
 
 // StorageAdder are the Boulder SA's write/update methods
 type StorageAdder interface {
 	NewRegistration(Registration) (Registration, error)
 	UpdateRegistration(Registration) error
+	UpdateRegistrationKey(int64, jose.JsonWebKey) error
+	DeactivateRegistration(int64) error
 
 	NewPendingAuthorization(Authorization) (Authorization, error)
 	UpdatePendingAuthorization(Authorization) error
+	UpdatePendingChallenge(string, int, Challenge) (Authorization, error)
 	FinalizeAuthorization(Authorization) error
+	DeactivateAuthorization(string) error
 	MarkCertificateRevoked(serial string, ocspResponse []byte, reasonCode int) error
 	UpdateOCSP(serial string, ocspResponse []byte) error
 
+	NewOrder(Order) (Order, error)
+	UpdateOrder(Order, AcmeStatus) error
+
 	AddCertificate([]byte, int64) (string, error)
 }
 
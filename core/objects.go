@@ -45,17 +45,20 @@ type ProblemDetails struct {
 
 // These statuses are the states of authorizations
 const (
-	StatusUnknown    = AcmeStatus("unknown")    // Unknown status; the default
-	StatusPending    = AcmeStatus("pending")    // In process; client has next action
-	StatusProcessing = AcmeStatus("processing") // In process; server has next action
-	StatusValid      = AcmeStatus("valid")      // Validation succeeded
-	StatusInvalid    = AcmeStatus("invalid")    // Validation failed
-	StatusRevoked    = AcmeStatus("revoked")    // Object no longer valid
+	StatusUnknown     = AcmeStatus("unknown")     // Unknown status; the default
+	StatusPending     = AcmeStatus("pending")     // In process; client has next action
+	StatusReady       = AcmeStatus("ready")       // Order authorized; client may finalize
+	StatusProcessing  = AcmeStatus("processing")  // In process; server has next action
+	StatusValid       = AcmeStatus("valid")       // Validation succeeded
+	StatusInvalid     = AcmeStatus("invalid")     // Validation failed
+	StatusRevoked     = AcmeStatus("revoked")     // Object no longer valid
+	StatusDeactivated = AcmeStatus("deactivated") // Object withdrawn by its owner
 )
 
 // These types are the available identification mechanisms
 const (
 	IdentifierDNS = IdentifierType("dns")
+	IdentifierIP  = IdentifierType("ip")
 )
 
 // The types of ACME resources
@@ -63,9 +66,15 @@ const (
 	ResourceNewReg       = AcmeResource("new-reg")
 	ResourceNewAuthz     = AcmeResource("new-authz")
 	ResourceNewCert      = AcmeResource("new-cert")
+	ResourceNewOrder     = AcmeResource("new-order")
+	ResourceFinalize     = AcmeResource("finalize")
 	ResourceRevokeCert   = AcmeResource("revoke-cert")
 	ResourceRegistration = AcmeResource("reg")
 	ResourceChallenge    = AcmeResource("challenge")
+	ResourceAuthz        = AcmeResource("authz")
+	ResourceKeyChange    = AcmeResource("key-change")
+	ResourceAuthzList    = AcmeResource("authorizations")
+	ResourceCertList     = AcmeResource("certificates")
 )
 
 // These status are the states of OCSP
@@ -74,10 +83,26 @@ const (
 	OCSPStatusRevoked = OCSPStatus("revoked")
 )
 
+// RevocationReasons maps the RFC 5280 CRLReason codes to their names
+var RevocationReasons = map[int]string{
+	0: "unspecified",
+	1: "keyCompromise",
+	2: "cACompromise",
+	3: "affiliationChanged",
+	4: "superseded",
+	5: "cessationOfOperation",
+	6: "certificateHold",
+	// 7 is unused
+	8:  "removeFromCRL", // needed?
+	9:  "privilegeWithdrawn",
+	10: "aAcompromise",
+}
+
 // Error types that can be used in ACME payloads
 const (
 	ConnectionProblem     = ProblemType("urn:acme:error:connection")
 	MalformedProblem      = ProblemType("urn:acme:error:malformed")
+	RateLimitedProblem    = ProblemType("urn:acme:error:rateLimited")
 	ServerInternalProblem = ProblemType("urn:acme:error:serverInternal")
 	TLSProblem            = ProblemType("urn:acme:error:tls")
 	UnauthorizedProblem   = ProblemType("urn:acme:error:unauthorized")
@@ -89,6 +114,9 @@ const (
 	ChallengeTypeSimpleHTTP = "simpleHttp"
 	ChallengeTypeDVSNI      = "dvsni"
 	ChallengeTypeDNS        = "dns"
+	ChallengeTypeHTTP01     = "http-01"
+	ChallengeTypeDNS01      = "dns-01"
+	ChallengeTypeTLSALPN01  = "tls-alpn-01"
 )
 
 // The suffix appended to pseudo-domain names in DVSNI challenges
@@ -151,7 +179,7 @@ func cmpIPSlice(a, b []net.IP) bool {
 // be validated by ACME.  The protocol allows for different
 // types of identifier to be supported (DNS names, IP
 // addresses, etc.), but currently we only support
-// domain names.
+// domain names and IP addresses.
 type AcmeIdentifier struct {
 	Type  IdentifierType `json:"type"`  // The type of identifier being encoded
 	Value string         `json:"value"` // The identifier itself
@@ -209,6 +237,20 @@ type Registration struct {
 	// Agreement with terms of service
 	Agreement string `json:"agreement,omitempty" db:"agreement"`
 
+	// Status is StatusValid, or StatusDeactivated once the owner has
+	// deactivated the registration. Older registrations may have no status,
+	// which is equivalent to StatusValid.
+	Status AcmeStatus `json:"status,omitempty" db:"status"`
+
+	// The IP address the registration was created from, and when
+	InitialIP net.IP     `json:"initialIp,omitempty" db:"initialIp"`
+	CreatedAt *time.Time `json:"createdAt,omitempty" db:"createdAt"`
+
+	// URLs of the collections of authorizations and certificates owned by
+	// this registration. These are filled in by the WFE and not stored.
+	Authorizations string `json:"authorizations,omitempty" db:"-"`
+	Certificates   string `json:"certificates,omitempty" db:"-"`
+
 	LockCol int64 `json:"-"`
 }
 
@@ -246,9 +288,13 @@ type Challenge struct {
 	// A URI to which a response can be POSTed
 	URI AcmeURL `json:"uri"`
 
-	// Used by simpleHttp, dvsni, and dns challenges
+	// Used by simpleHttp, http-01, dvsni, and dns challenges
 	Token string `json:"token,omitempty"`
 
+	// Used by http-01 challenges: the token and the account key's
+	// thumbprint, which the client serves as the challenge response
+	KeyAuthorization string `json:"keyAuthorization,omitempty"`
+
 	// Used by simpleHTTP challenges
 	TLS *bool `json:"tls,omitempty"`
 
@@ -281,6 +327,34 @@ func (ch Challenge) IsSane(completed bool) bool {
 		if _, err := B64dec(ch.Token); err != nil {
 			return false
 		}
+	case ChallengeTypeHTTP01:
+		// Same as tls-alpn-01
+		fallthrough
+	case ChallengeTypeDNS01:
+		// Same as tls-alpn-01
+		fallthrough
+	case ChallengeTypeTLSALPN01:
+		// check extra fields aren't used
+		if ch.TLS != nil || ch.Validation != nil {
+			return false
+		}
+
+		// check token is present, corrent length, and contains b64 encoded string
+		if ch.Token == "" || len(ch.Token) != 43 {
+			return false
+		}
+		if _, err := B64dec(ch.Token); err != nil {
+			return false
+		}
+
+		// The key authorization is only provided with the response, and
+		// must be for this challenge's token
+		if !completed && ch.KeyAuthorization != "" {
+			return false
+		}
+		if completed && !strings.HasPrefix(ch.KeyAuthorization, ch.Token+".") {
+			return false
+		}
 	case ChallengeTypeDVSNI:
 		// Same as DNS
 		fallthrough
@@ -324,6 +398,15 @@ func (ch Challenge) MergeResponse(resp Challenge) Challenge {
 			*ch.TLS = true
 		}
 
+	case ChallengeTypeHTTP01:
+		fallthrough
+	case ChallengeTypeDNS01:
+		fallthrough
+	case ChallengeTypeTLSALPN01:
+		// For http-01, dns-01 and tls-alpn-01, only "keyAuthorization" is
+		// client-provided
+		ch.KeyAuthorization = resp.KeyAuthorization
+
 	case ChallengeTypeDVSNI:
 		fallthrough
 	case ChallengeTypeDNS:
@@ -370,6 +453,45 @@ type Authorization struct {
 	Combinations [][]int `json:"combinations,omitempty" db:"combinations"`
 }
 
+// Order bundles the identifiers a subscriber wants in a certificate with the
+// authorizations needed for them. Once every authorization is valid, the
+// order is ready, and the subscriber finalizes it by submitting a CSR for
+// those identifiers. Like Authorization, internal fields (e.g., ID, regID)
+// must be made empty before marshaling for the wire.
+type Order struct {
+	// An identifier for this order, unique within this instance
+	ID string `json:"id,omitempty" db:"id"`
+
+	// The registration that placed the order
+	RegistrationID int64 `json:"regId,omitempty" db:"registrationID"`
+
+	// The status of the order: pending until all of its authorizations are
+	// valid, then ready, processing while the certificate is being issued,
+	// and finally valid or invalid
+	Status AcmeStatus `json:"status,omitempty" db:"status"`
+
+	// The date after which the order can no longer be finalized
+	Expires *time.Time `json:"expires,omitempty" db:"expires"`
+
+	// The identifiers to be included in the certificate
+	Identifiers []AcmeIdentifier `json:"identifiers,omitempty" db:"identifiers"`
+
+	// The IDs of the authorizations for the identifiers, in the same order.
+	// The WFE replaces these with URLs.
+	Authorizations []string `json:"authorizations,omitempty" db:"authorizations"`
+
+	// The serial of the certificate issued for the order, once it is valid
+	CertificateSerial string `json:"certificateSerial,omitempty" db:"certificateSerial"`
+
+	// Why the order became invalid, if it failed during issuance
+	Error *ProblemDetails `json:"error,omitempty" db:"error"`
+
+	// URLs at which to finalize the order and to fetch its certificate.
+	// These are filled in by the WFE and not stored.
+	Finalize    string `json:"finalize,omitempty" db:"-"`
+	Certificate string `json:"certificate,omitempty" db:"-"`
+}
+
 // JSONBuffer fields get encoded and decoded JOSE-style, in base64url encoding
 // with stripped padding.
 type JSONBuffer []byte
@@ -437,12 +559,7 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 	}
 
 	// Check issued certificate matches what was expected from the CSR
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		hostNames = append(hostNames, csr.Subject.CommonName)
-	}
-	hostNames = UniqueNames(hostNames)
+	hostNames, ipAddresses := CSRNames(csr)
 
 	if !KeyDigestEquals(parsedCertificate.PublicKey, csr.PublicKey) {
 		err = InternalServerError("Generated certificate public key doesn't match CSR public key")
@@ -456,7 +573,7 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 		err = InternalServerError("Generated certificate DNSNames don't match CSR DNSNames")
 		return
 	}
-	if !cmpIPSlice(parsedCertificate.IPAddresses, csr.IPAddresses) {
+	if !cmpIPSlice(parsedCertificate.IPAddresses, ipAddresses) {
 		err = InternalServerError("Generated certificate IPAddresses don't match CSR IPAddresses")
 		return
 	}
@@ -42,7 +42,7 @@ func TestRegistrationUpdate(t *testing.T) {
 }
 
 func TestSanityCheck(t *testing.T) {
-	types := []string{ChallengeTypeSimpleHTTP, ChallengeTypeDVSNI, ChallengeTypeDNS}
+	types := []string{ChallengeTypeSimpleHTTP, ChallengeTypeDVSNI, ChallengeTypeDNS, ChallengeTypeHTTP01, ChallengeTypeDNS01, ChallengeTypeTLSALPN01}
 	for _, challengeType := range types {
 		chall := Challenge{Type: challengeType, Status: StatusInvalid}
 		test.Assert(t, !chall.IsSane(false), "IsSane should be false")
@@ -64,6 +64,14 @@ func TestSanityCheck(t *testing.T) {
 		} else if challengeType == ChallengeTypeDVSNI || challengeType == ChallengeTypeDNS {
 			chall.Validation = new(jose.JsonWebSignature)
 			test.Assert(t, chall.IsSane(true), "IsSane should be true")
+		} else {
+			test.Assert(t, chall.IsSane(false), "IsSane should be true")
+			test.Assert(t, !chall.IsSane(true), "IsSane should be false without a key authorization")
+			chall.KeyAuthorization = "anothertoken.thumbprint"
+			test.Assert(t, !chall.IsSane(true), "IsSane should be false for another token")
+			test.Assert(t, !chall.IsSane(false), "IsSane should be false before the response")
+			chall.KeyAuthorization = chall.Token + ".thumbprint"
+			test.Assert(t, chall.IsSane(true), "IsSane should be true")
 		}
 	}
 
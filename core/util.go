@@ -8,6 +8,7 @@ package core
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -24,6 +25,7 @@ import (
 	"hash"
 	"io"
 	"math/big"
+	"net"
 	"net/url"
 	"strings"
 )
@@ -74,6 +76,9 @@ type SignatureValidationError string
 // for some reason.
 type CertificateIssuanceError string
 
+// RateLimitedError indicates the user has hit a rate limit
+type RateLimitedError string
+
 func (e InternalServerError) Error() string      { return string(e) }
 func (e NotSupportedError) Error() string        { return string(e) }
 func (e MalformedRequestError) Error() string    { return string(e) }
@@ -82,6 +87,7 @@ func (e NotFoundError) Error() string            { return string(e) }
 func (e SyntaxError) Error() string              { return string(e) }
 func (e SignatureValidationError) Error() string { return string(e) }
 func (e CertificateIssuanceError) Error() string { return string(e) }
+func (e RateLimitedError) Error() string         { return string(e) }
 
 // Base64 functions
 
@@ -158,6 +164,53 @@ func KeyDigest(key crypto.PublicKey) (string, error) {
 	}
 }
 
+// Thumbprint produces the RFC 7638 thumbprint of a JWK: the unpadded,
+// URL-safe Base64-encoded SHA256 digest of the key's required members,
+// serialized in lexicographic order.
+func Thumbprint(key *jose.JsonWebKey) (string, error) {
+	if key == nil {
+		return "", errors.New("No key to thumbprint")
+	}
+
+	var members string
+	switch k := key.Key.(type) {
+	case *rsa.PrivateKey:
+		return Thumbprint(&jose.JsonWebKey{Key: &k.PublicKey})
+	case *ecdsa.PrivateKey:
+		return Thumbprint(&jose.JsonWebKey{Key: &k.PublicKey})
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(k.E))
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, B64enc(e.Bytes()), B64enc(k.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		var crv string
+		switch k.Curve {
+		case elliptic.P256():
+			crv = "P-256"
+		case elliptic.P384():
+			crv = "P-384"
+		case elliptic.P521():
+			crv = "P-521"
+		default:
+			return "", errors.New("Unsupported curve")
+		}
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, crv, B64enc(padBytes(k.X.Bytes(), size)), B64enc(padBytes(k.Y.Bytes(), size)))
+	default:
+		return "", errors.New("Unsupported key type")
+	}
+	return Fingerprint256([]byte(members)), nil
+}
+
+// padBytes left-pads b with zeros to length bytes.
+func padBytes(b []byte, length int) []byte {
+	if len(b) >= length {
+		return b
+	}
+	padded := make([]byte, length)
+	copy(padded[length-len(b):], b)
+	return padded
+}
+
 // KeyDigestEquals determines whether two public keys have the same digest.
 func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	digestJ, errJ := KeyDigest(j)
@@ -170,6 +223,32 @@ func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	return digestJ == digestK
 }
 
+// CheckJWSAlgorithm verifies that a JWS signature algorithm is acceptable for
+// the key that made the signature: RS* or PS* for RSA keys, ES256 for P-256
+// keys, and ES384 for P-384 keys. ECDSA keys must also pass GoodKeyECDSA,
+// since parsing a JWK does not check that its point is on the curve.
+func CheckJWSAlgorithm(key *jose.JsonWebKey, alg string) error {
+	if key == nil {
+		return SignatureValidationError("No JWK in JWS header")
+	}
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		switch jose.SignatureAlgorithm(alg) {
+		case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if err := GoodKeyECDSA(*k, 0); err != nil {
+			return SignatureValidationError(fmt.Sprintf("Invalid ECDSA key: %s", err))
+		}
+		if (k.Curve == elliptic.P256() && alg == string(jose.ES256)) ||
+			(k.Curve == elliptic.P384() && alg == string(jose.ES384)) {
+			return nil
+		}
+	}
+	return SignatureValidationError(fmt.Sprintf("Signature algorithm '%s' not supported for key type %T", alg, key.Key))
+}
+
 // AcmeURL is a URL that automatically marshal/unmarshal to JSON strings
 type AcmeURL url.URL
 
@@ -332,3 +411,38 @@ func UniqueNames(names []string) (unique []string) {
 	}
 	return
 }
+
+// CSRNames returns the DNS names and IP addresses requested by a CSR, in the
+// order they appear with duplicates removed. A commonName is added to the IP
+// addresses if it is an IP address literal, and to the DNS names otherwise.
+func CSRNames(csr *x509.CertificateRequest) (dnsNames []string, ipAddresses []net.IP) {
+	seenNames := make(map[string]bool)
+	addName := func(name string) {
+		if !seenNames[name] {
+			seenNames[name] = true
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	seenIPs := make(map[string]bool)
+	addIP := func(ip net.IP) {
+		if !seenIPs[ip.String()] {
+			seenIPs[ip.String()] = true
+			ipAddresses = append(ipAddresses, ip)
+		}
+	}
+
+	for _, name := range csr.DNSNames {
+		addName(name)
+	}
+	for _, ip := range csr.IPAddresses {
+		addIP(ip)
+	}
+	if cn := csr.Subject.CommonName; len(cn) > 0 {
+		if ip := net.ParseIP(cn); ip != nil {
+			addIP(ip)
+		} else {
+			addName(cn)
+		}
+	}
+	return
+}
@@ -6,12 +6,19 @@
 package core
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/test"
 	"math"
 	"math/big"
+	"net"
 	"net/url"
 	"testing"
 )
@@ -79,6 +86,38 @@ func TestKeyDigest(t *testing.T) {
 	test.Assert(t, err != nil, "Should have rejected unknown key type")
 }
 
+func TestThumbprint(t *testing.T) {
+	// Example from RFC 7638, section 3.1
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(`{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e": "AQAB"
+	}`), &jwk)
+	test.AssertNotError(t, err, "Failed to unmarshal JWK")
+	thumbprint, err := Thumbprint(&jwk)
+	test.AssertNotError(t, err, "Failed to thumbprint JWK")
+	test.AssertEquals(t, thumbprint, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+
+	keyAuthorization, err := NewKeyAuthorization("token", &jwk)
+	test.AssertNotError(t, err, "Failed to make key authorization")
+	test.AssertEquals(t, keyAuthorization, "token.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+
+	// ECDSA keys use fixed-length coordinates
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	thumbprint, err = Thumbprint(&jose.JsonWebKey{Key: &priv.PublicKey})
+	test.AssertNotError(t, err, "Failed to thumbprint ECDSA key")
+	fromPrivate, err := Thumbprint(&jose.JsonWebKey{Key: priv})
+	test.AssertNotError(t, err, "Failed to thumbprint private ECDSA key")
+	test.AssertEquals(t, thumbprint, fromPrivate)
+
+	_, err = Thumbprint(&jose.JsonWebKey{Key: []byte("secret")})
+	test.AssertError(t, err, "Thumbprinted an unsupported key")
+	_, err = Thumbprint(nil)
+	test.AssertError(t, err, "Thumbprinted a missing key")
+}
+
 func TestKeyDigestEquals(t *testing.T) {
 	var jwk1, jwk2 jose.JsonWebKey
 	json.Unmarshal([]byte(JWK1JSON), &jwk1)
@@ -96,3 +135,47 @@ func TestAcmeURL(t *testing.T) {
 	a := AcmeURL(*u)
 	test.AssertEquals(t, s, a.String())
 }
+
+func TestCSRNames(t *testing.T) {
+	csr := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "192.0.2.1"},
+		DNSNames:    []string{"example.com", "example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+	}
+	dnsNames, ipAddresses := CSRNames(csr)
+	test.AssertEquals(t, len(dnsNames), 1)
+	test.AssertEquals(t, dnsNames[0], "example.com")
+	test.AssertEquals(t, len(ipAddresses), 2)
+
+	csr.Subject.CommonName = "www.example.com"
+	dnsNames, ipAddresses = CSRNames(csr)
+	test.AssertEquals(t, len(dnsNames), 2)
+	test.AssertEquals(t, dnsNames[1], "www.example.com")
+	test.AssertEquals(t, len(ipAddresses), 2)
+}
+
+func TestCheckJWSAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate key")
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+
+	rsaJWK := &jose.JsonWebKey{Key: &rsaKey.PublicKey}
+	p256JWK := &jose.JsonWebKey{Key: &p256Key.PublicKey}
+	p384JWK := &jose.JsonWebKey{Key: &p384Key.PublicKey}
+
+	test.AssertNotError(t, CheckJWSAlgorithm(rsaJWK, "RS256"), "Rejected RS256 with RSA key")
+	test.AssertNotError(t, CheckJWSAlgorithm(p256JWK, "ES256"), "Rejected ES256 with P-256 key")
+	test.AssertNotError(t, CheckJWSAlgorithm(p384JWK, "ES384"), "Rejected ES384 with P-384 key")
+
+	test.AssertError(t, CheckJWSAlgorithm(nil, "RS256"), "Accepted missing key")
+	test.AssertError(t, CheckJWSAlgorithm(rsaJWK, "ES256"), "Accepted ES256 with RSA key")
+	test.AssertError(t, CheckJWSAlgorithm(p256JWK, "ES384"), "Accepted ES384 with P-256 key")
+	test.AssertError(t, CheckJWSAlgorithm(p384JWK, "ES256"), "Accepted ES256 with P-384 key")
+	test.AssertError(t, CheckJWSAlgorithm(p256JWK, "none"), "Accepted alg none")
+
+	offCurve := &jose.JsonWebKey{Key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: big.NewInt(1), Y: big.NewInt(1)}}
+	test.AssertError(t, CheckJWSAlgorithm(offCurve, "ES256"), "Accepted point not on the curve")
+}
@@ -15,9 +15,13 @@ CREATE TABLE `registrations` (
   `recoveryToken` varchar(255) DEFAULT NULL,
   `contact` varchar(255) DEFAULT NULL,
   `agreement` varchar(255) DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  `initialIp` binary(16) DEFAULT NULL,
+  `createdAt` datetime DEFAULT NULL,
   `LockCol` bigint(20) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_registrations_jwk` (`jwk`(255)) COMMENT 'Used by GetRegistrationByKey'
+  KEY `idx_registrations_jwk` (`jwk`(255)) COMMENT 'Used by GetRegistrationByKey',
+  KEY `idx_registrations_initialIp_createdAt` (`initialIp`,`createdAt`) COMMENT 'Used by CountRegistrationsByIP'
 ) ENGINE=InnoDB AUTO_INCREMENT=70 DEFAULT CHARSET=utf8;
 
 CREATE TABLE `authz` (
@@ -29,6 +33,7 @@ CREATE TABLE `authz` (
   `challenges` varchar(1536) DEFAULT NULL,
   `combinations` varchar(255) DEFAULT NULL,
   `sequence` bigint(20) DEFAULT NULL,
+  `failed` datetime DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `regId_idx` (`registrationID`),
   CONSTRAINT `regId_authz` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
@@ -71,6 +76,25 @@ CREATE TABLE `deniedCSRs` (
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `fqdnSets` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `setHash` binary(32) NOT NULL,
+  `serial` varchar(255) NOT NULL,
+  `issued` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `setHash_issued_idx` (`setHash`,`issued`) COMMENT 'Used by CountFQDNSets'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `issuedNames` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `reversedName` varchar(640) NOT NULL,
+  `serial` varchar(255) NOT NULL,
+  `issued` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `reversedName_issued_idx` (`reversedName`,`issued`) COMMENT 'Used by CountCertificatesByNames'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `ocspResponses` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `serial` varchar(255) NOT NULL,
@@ -80,6 +104,20 @@ CREATE TABLE `ocspResponses` (
   KEY `SERIAL` (`serial`) COMMENT 'Actual lookup mechanism'
 ) ENGINE=InnoDB AUTO_INCREMENT=27 DEFAULT CHARSET=utf8;
 
+CREATE TABLE `orders` (
+  `id` varchar(255) NOT NULL,
+  `registrationID` bigint(20) DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  `expires` datetime DEFAULT NULL,
+  `identifiers` varchar(1536) DEFAULT NULL,
+  `authorizations` varchar(1536) DEFAULT NULL,
+  `certificateSerial` varchar(255) DEFAULT NULL,
+  `error` varchar(1024) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `regId_status_orders_idx` (`registrationID`,`status`) COMMENT 'Used by GetPendingOrders',
+  CONSTRAINT `regId_orders` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `pending_authz` (
   `id` varchar(255) NOT NULL,
   `identifier` varchar(255) DEFAULT NULL,
@@ -16,7 +16,10 @@ GRANT SELECT,INSERT,UPDATE,DELETE ON pending_authz TO 'sa'@'%';
 GRANT SELECT,INSERT ON certificates TO 'sa'@'%';
 GRANT SELECT,INSERT,UPDATE ON certificateStatus TO 'sa'@'%';
 GRANT SELECT,INSERT ON deniedCSRs TO 'sa'@'%';
+GRANT SELECT,INSERT ON fqdnSets TO 'sa'@'%';
+GRANT SELECT,INSERT ON issuedNames TO 'sa'@'%';
 GRANT INSERT ON ocspResponses TO 'sa'@'%';
+GRANT SELECT,INSERT,UPDATE ON orders TO 'sa'@'%';
 GRANT SELECT,INSERT,UPDATE ON registrations TO 'sa'@'%';
 
 -- OCSP Responder
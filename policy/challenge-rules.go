@@ -0,0 +1,342 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// challengeTypes are the challenge types the PA can offer, with the functions
+// that construct fresh challenges of each type, in the order they are
+// offered.
+var challengeTypes = []struct {
+	Type string
+	New  func() core.Challenge
+}{
+	{core.ChallengeTypeSimpleHTTP, core.SimpleHTTPChallenge},
+	{core.ChallengeTypeDVSNI, core.DvsniChallenge},
+	{core.ChallengeTypeDNS, core.DNSChallenge},
+	{core.ChallengeTypeHTTP01, core.HTTPChallenge01},
+	{core.ChallengeTypeDNS01, core.DNSChallenge01},
+	{core.ChallengeTypeTLSALPN01, core.TLSALPNChallenge01},
+}
+
+func knownChallengeType(challengeType string) bool {
+	for _, known := range challengeTypes {
+		if known.Type == challengeType {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsChallengeTypes are the challenge types that prove control of a name
+// through DNS. They are the only ones that can validate a wildcard, and
+// cannot validate an IP address.
+var dnsChallengeTypes = map[string]bool{
+	core.ChallengeTypeDNS:   true,
+	core.ChallengeTypeDNS01: true,
+}
+
+// IsDNSChallenge returns true if a challenge type proves control of a name
+// through DNS.
+func IsDNSChallenge(challengeType string) bool {
+	return dnsChallengeTypes[challengeType]
+}
+
+// ChallengeRule chooses the challenges offered for the identifiers it
+// matches. Each condition that is set must hold for the rule to match; a rule
+// without conditions matches everything.
+type ChallengeRule struct {
+	// IdentifierTypes matches identifiers of these types.
+	IdentifierTypes []core.IdentifierType
+
+	// Suffixes matches names equal to, or under, one of these domains.
+	Suffixes []string
+
+	// RegisteredDomains matches names registered under one of these
+	// domains (see RegisteredDomain).
+	RegisteredDomains []string
+
+	// Wildcard, if set, matches only wildcard or only non-wildcard names.
+	Wildcard *bool
+
+	// RiskTiers matches names in one of these risk tiers.
+	RiskTiers []string
+
+	// Registrations matches requests from these registration IDs.
+	Registrations []int64
+
+	// Combinations lists the sets of challenge types that are each enough to
+	// validate a matching identifier, e.g. [["simpleHttp"], ["dns"]].
+	Combinations [][]string
+}
+
+// ChallengeRules are the rules ChallengesFor applies.
+type ChallengeRules struct {
+	// Disabled challenge types are never offered. A combination that needs
+	// one is dropped.
+	Disabled []string
+
+	// RiskTiers assigns a risk tier, such as "high", to the names under
+	// each domain. The most specific domain wins.
+	RiskTiers map[string]string
+
+	// Rules are tried in order, and the first one that matches decides. If
+	// there are none, the default rules are used.
+	Rules []ChallengeRule
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// defaultChallengeRules are the rules used without a rules file: wildcards
+// are validated through DNS, IP addresses through their server, high risk
+// names through both, and other names through any one challenge.
+var defaultChallengeRules = ChallengeRules{
+	Rules: []ChallengeRule{
+		ChallengeRule{
+			Wildcard:     boolPtr(true),
+			Combinations: [][]string{[]string{core.ChallengeTypeDNS}, []string{core.ChallengeTypeDNS01}},
+		},
+		ChallengeRule{
+			IdentifierTypes: []core.IdentifierType{core.IdentifierIP},
+			Combinations: [][]string{
+				[]string{core.ChallengeTypeSimpleHTTP},
+				[]string{core.ChallengeTypeDVSNI},
+				[]string{core.ChallengeTypeHTTP01},
+			},
+		},
+		ChallengeRule{
+			RiskTiers: []string{"high"},
+			Combinations: [][]string{
+				[]string{core.ChallengeTypeSimpleHTTP, core.ChallengeTypeDNS},
+				[]string{core.ChallengeTypeDVSNI, core.ChallengeTypeDNS},
+				[]string{core.ChallengeTypeHTTP01, core.ChallengeTypeDNS},
+				[]string{core.ChallengeTypeHTTP01, core.ChallengeTypeDNS01},
+				[]string{core.ChallengeTypeTLSALPN01, core.ChallengeTypeDNS},
+				[]string{core.ChallengeTypeTLSALPN01, core.ChallengeTypeDNS01},
+			},
+		},
+		ChallengeRule{
+			Combinations: [][]string{
+				[]string{core.ChallengeTypeSimpleHTTP},
+				[]string{core.ChallengeTypeDVSNI},
+				[]string{core.ChallengeTypeDNS},
+				[]string{core.ChallengeTypeHTTP01},
+				[]string{core.ChallengeTypeDNS01},
+				[]string{core.ChallengeTypeTLSALPN01},
+			},
+		},
+	},
+}
+
+// validate checks that the rules only name challenge types the PA knows.
+func (rules ChallengeRules) validate() error {
+	for _, challengeType := range rules.Disabled {
+		if !knownChallengeType(challengeType) {
+			return fmt.Errorf("Unknown challenge type %s", challengeType)
+		}
+	}
+	for i, rule := range rules.Rules {
+		if len(rule.Combinations) == 0 {
+			return fmt.Errorf("Rule %d has no combinations", i)
+		}
+		for _, combination := range rule.Combinations {
+			if len(combination) == 0 {
+				return fmt.Errorf("Rule %d has an empty combination", i)
+			}
+			for _, challengeType := range combination {
+				if !knownChallengeType(challengeType) {
+					return fmt.Errorf("Rule %d has unknown challenge type %s", i, challengeType)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// disabled returns true if the rules disable the challenge type.
+func (rules ChallengeRules) disabled(challengeType string) bool {
+	for _, disabledType := range rules.Disabled {
+		if disabledType == challengeType {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if every condition of the rule holds.
+func (rule ChallengeRule) matches(identifier core.AcmeIdentifier, regID int64, tier string) bool {
+	name := strings.ToLower(WildcardBase(identifier.Value))
+
+	if len(rule.IdentifierTypes) > 0 {
+		found := false
+		for _, identifierType := range rule.IdentifierTypes {
+			found = found || identifierType == identifier.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.Suffixes) > 0 {
+		if identifier.Type != core.IdentifierDNS {
+			return false
+		}
+		suffixes := make(map[string]bool)
+		for _, suffix := range rule.Suffixes {
+			suffixes[strings.ToLower(suffix)] = true
+		}
+		if !suffixMatch(strings.Split(name, "."), suffixes, false) {
+			return false
+		}
+	}
+	if len(rule.RegisteredDomains) > 0 {
+		if identifier.Type != core.IdentifierDNS {
+			return false
+		}
+		registered, err := RegisteredDomain(name)
+		found := false
+		for _, domain := range rule.RegisteredDomains {
+			found = found || (err == nil && strings.ToLower(domain) == registered)
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.Wildcard != nil && *rule.Wildcard != IsWildcard(identifier.Value) {
+		return false
+	}
+	if len(rule.RiskTiers) > 0 {
+		found := false
+		for _, riskTier := range rule.RiskTiers {
+			found = found || (tier != "" && riskTier == tier)
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.Registrations) > 0 {
+		found := false
+		for _, id := range rule.Registrations {
+			found = found || id == regID
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// challengeRuleSet holds the rules in force, which may be replaced while the
+// PA is in use.
+type challengeRuleSet struct {
+	sync.RWMutex
+	rules ChallengeRules
+}
+
+func (set *challengeRuleSet) get() ChallengeRules {
+	if set == nil {
+		return defaultChallengeRules
+	}
+	set.RLock()
+	defer set.RUnlock()
+	return set.rules
+}
+
+func (set *challengeRuleSet) set(rules ChallengeRules) {
+	set.Lock()
+	defer set.Unlock()
+	set.rules = rules
+}
+
+// SetChallengeRules replaces the rules ChallengesFor applies. If rules has no
+// rules of its own, the default rules are used with its disabled challenge
+// types and risk tiers.
+func (pa *PolicyAuthorityImpl) SetChallengeRules(rules ChallengeRules) error {
+	if err := rules.validate(); err != nil {
+		return err
+	}
+	if len(rules.Rules) == 0 {
+		rules.Rules = defaultChallengeRules.Rules
+	}
+	if pa.challengeRules == nil {
+		pa.challengeRules = &challengeRuleSet{}
+	}
+	pa.challengeRules.set(rules)
+	return nil
+}
+
+// LoadChallengeRules reads challenge rules from a JSON file and puts them in
+// force.
+func (pa *PolicyAuthorityImpl) LoadChallengeRules(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var rules ChallengeRules
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("Couldn't parse challenge rules [%s]: %s", filename, err)
+	}
+	if err = pa.SetChallengeRules(rules); err != nil {
+		return fmt.Errorf("Invalid challenge rules [%s]: %s", filename, err)
+	}
+	return nil
+}
+
+// WatchChallengeRules reloads the challenge rules file whenever it changes,
+// checking every interval, so that rules such as disabling a challenge type
+// take effect without a restart. If the new rules can't be loaded, the old
+// ones stay in force. It does not return.
+func (pa *PolicyAuthorityImpl) WatchChallengeRules(filename string, interval time.Duration) {
+	var lastModified time.Time
+	if info, err := os.Stat(filename); err == nil {
+		lastModified = info.ModTime()
+	}
+	for {
+		time.Sleep(interval)
+		info, err := os.Stat(filename)
+		if err != nil {
+			pa.log.Warning(fmt.Sprintf("Couldn't check challenge rules [%s]: %s", filename, err))
+			continue
+		}
+		if info.ModTime().Equal(lastModified) {
+			continue
+		}
+		lastModified = info.ModTime()
+		if err = pa.LoadChallengeRules(filename); err != nil {
+			pa.log.Warning(fmt.Sprintf("Keeping previous challenge rules: %s", err))
+			continue
+		}
+		pa.log.Notice(fmt.Sprintf("Reloaded challenge rules [%s]", filename))
+	}
+}
+
+// riskTier returns the risk tier of a name, or "" if it has none. Names
+// under the PA's HighRisk domains are in the "high" tier unless the rules
+// give a more specific domain another tier.
+func (pa PolicyAuthorityImpl) riskTier(name string, rules ChallengeRules) string {
+	labels := strings.Split(strings.ToLower(WildcardBase(name)), ".")
+	for i := range labels {
+		domain := strings.Join(labels[i:], ".")
+		if tier, present := rules.RiskTiers[domain]; present {
+			return tier
+		}
+		if pa.HighRisk[domain] {
+			return "high"
+		}
+	}
+	return ""
+}
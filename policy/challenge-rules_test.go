@@ -0,0 +1,144 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func typesOf(challenges []core.Challenge) (types []string) {
+	for _, challenge := range challenges {
+		types = append(types, challenge.Type)
+	}
+	return
+}
+
+func dnsName(name string) core.AcmeIdentifier {
+	return core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+}
+
+func TestLoadChallengeRules(t *testing.T) {
+	pa := NewPolicyAuthorityImpl()
+	err := pa.LoadChallengeRules("../test/challenge-rules.json")
+	test.AssertNotError(t, err, "Couldn't load challenge rules")
+
+	challenges, combinations := pa.ChallengesFor(dnsName("www.zombo.com"), 1)
+	test.AssertEquals(t, len(challenges), 6)
+	test.AssertEquals(t, len(combinations), 6)
+
+	// By risk tier
+	challenges, combinations = pa.ChallengesFor(dnsName("www.bank.zombo.com"), 1)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeSimpleHTTP, core.ChallengeTypeDVSNI, core.ChallengeTypeDNS, core.ChallengeTypeHTTP01, core.ChallengeTypeDNS01, core.ChallengeTypeTLSALPN01})
+	test.AssertMarshaledEquals(t, combinations, [][]int{[]int{0, 2}, []int{1, 2}, []int{3, 2}, []int{3, 4}, []int{5, 2}, []int{5, 4}})
+
+	// By registered domain
+	challenges, combinations = pa.ChallengesFor(dnsName("www.dvsni-only.co.uk"), 1)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeDVSNI})
+	test.AssertMarshaledEquals(t, combinations, [][]int{[]int{0}})
+	challenges, _ = pa.ChallengesFor(dnsName("dvsni-only.co"), 1)
+	test.AssertEquals(t, len(challenges), 6)
+
+	// By registration
+	challenges, _ = pa.ChallengesFor(dnsName("www.zombo.com"), 1000)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeDNS})
+
+	// The registration's rule can't offer DNS for an IP address
+	challenges, _ = pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "8.8.8.8"}, 1000)
+	test.AssertEquals(t, len(challenges), 0)
+
+	err = pa.LoadChallengeRules("../test/does-not-exist.json")
+	test.AssertError(t, err, "Loaded missing challenge rules")
+}
+
+func TestChallengeRuleSuffixes(t *testing.T) {
+	pa := NewPolicyAuthorityImpl()
+	err := pa.SetChallengeRules(ChallengeRules{
+		Rules: []ChallengeRule{
+			ChallengeRule{
+				Suffixes:     []string{"Zombo.com"},
+				Combinations: [][]string{[]string{core.ChallengeTypeDNS}},
+			},
+			ChallengeRule{
+				Combinations: [][]string{[]string{core.ChallengeTypeSimpleHTTP}},
+			},
+		},
+	})
+	test.AssertNotError(t, err, "Couldn't set challenge rules")
+
+	for _, name := range []string{"zombo.com", "www.zombo.com", "*.zombo.com"} {
+		challenges, _ := pa.ChallengesFor(dnsName(name), 1)
+		test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeDNS})
+	}
+	challenges, _ := pa.ChallengesFor(dnsName("notzombo.com"), 1)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeSimpleHTTP})
+
+	// Only DNS can validate a wildcard
+	challenges, _ = pa.ChallengesFor(dnsName("*.notzombo.com"), 1)
+	test.AssertEquals(t, len(challenges), 0)
+}
+
+func TestDisabledChallenges(t *testing.T) {
+	pa := NewPolicyAuthorityImpl()
+	err := pa.SetChallengeRules(ChallengeRules{Disabled: []string{core.ChallengeTypeDVSNI}})
+	test.AssertNotError(t, err, "Couldn't set challenge rules")
+
+	challenges, combinations := pa.ChallengesFor(dnsName("www.zombo.com"), 1)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeSimpleHTTP, core.ChallengeTypeDNS, core.ChallengeTypeHTTP01, core.ChallengeTypeDNS01, core.ChallengeTypeTLSALPN01})
+	test.AssertMarshaledEquals(t, combinations, [][]int{[]int{0}, []int{1}, []int{2}, []int{3}, []int{4}})
+
+	pa.HighRisk = map[string]bool{"zombo.com": true}
+	challenges, combinations = pa.ChallengesFor(dnsName("www.zombo.com"), 1)
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeSimpleHTTP, core.ChallengeTypeDNS, core.ChallengeTypeHTTP01, core.ChallengeTypeDNS01, core.ChallengeTypeTLSALPN01})
+	test.AssertMarshaledEquals(t, combinations, [][]int{[]int{0, 1}, []int{2, 1}, []int{2, 3}, []int{4, 1}, []int{4, 3}})
+
+	test.Assert(t, !pa.ChallengeTypeEnabled(core.ChallengeTypeDVSNI), "Disabled challenge type is enabled")
+	test.Assert(t, pa.ChallengeTypeEnabled(core.ChallengeTypeHTTP01), "Challenge type is not enabled")
+	test.Assert(t, !pa.ChallengeTypeEnabled("carrier-pigeon"), "Unknown challenge type is enabled")
+
+	err = pa.SetChallengeRules(ChallengeRules{Disabled: []string{"carrier-pigeon"}})
+	test.AssertError(t, err, "Disabled an unknown challenge type")
+	err = pa.SetChallengeRules(ChallengeRules{Rules: []ChallengeRule{ChallengeRule{}}})
+	test.AssertError(t, err, "Accepted a rule without combinations")
+}
+
+func TestWatchChallengeRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "challenge-rules")
+	test.AssertNotError(t, err, "Couldn't create temporary directory")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "rules.json")
+	err = ioutil.WriteFile(filename, []byte(`{}`), 0644)
+	test.AssertNotError(t, err, "Couldn't write challenge rules")
+
+	pa := NewPolicyAuthorityImpl()
+	err = pa.LoadChallengeRules(filename)
+	test.AssertNotError(t, err, "Couldn't load challenge rules")
+	go pa.WatchChallengeRules(filename, 10*time.Millisecond)
+
+	// Make sure the modification time changes
+	time.Sleep(20 * time.Millisecond)
+	later := time.Now().Add(time.Minute)
+	err = ioutil.WriteFile(filename, []byte(`{"disabled": ["simpleHttp", "dvsni", "http-01", "dns-01", "tls-alpn-01"]}`), 0644)
+	test.AssertNotError(t, err, "Couldn't write challenge rules")
+	err = os.Chtimes(filename, later, later)
+	test.AssertNotError(t, err, "Couldn't change modification time")
+
+	var challenges []core.Challenge
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		challenges, _ = pa.ChallengesFor(dnsName("www.zombo.com"), 1)
+		if len(challenges) == 1 {
+			break
+		}
+	}
+	test.AssertMarshaledEquals(t, typesOf(challenges), []string{core.ChallengeTypeDNS})
+}
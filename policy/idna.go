@@ -0,0 +1,382 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IDNPolicy configures which internationalized domain name labels the PA
+// accepts. The zero value accepts labels in any single script, and rejects
+// labels that mix scripts or that are made up only of characters that look
+// like Latin letters.
+type IDNPolicy struct {
+	// AllowedScripts restricts labels to the listed Unicode scripts, named
+	// as in the unicode package (e.g. "Cyrillic", "Han"). An empty list
+	// allows any script.
+	AllowedScripts []string
+
+	// AllowMixedScript accepts labels that combine scripts beyond the
+	// combinations that UTS #39 permits at its "Highly Restrictive" level.
+	AllowMixedScript bool
+
+	// AllowConfusables accepts Cyrillic and Greek labels made up entirely of
+	// letters that can be mistaken for Latin ones.
+	AllowConfusables bool
+}
+
+// InvalidIDNError indicates that an A-label was not a valid IDNA2008 label.
+type InvalidIDNError struct{}
+
+// DisallowedScriptError indicates that an internationalized label used a
+// script that the IDN policy does not allow.
+type DisallowedScriptError struct{}
+
+// MixedScriptError indicates that an internationalized label mixed scripts.
+type MixedScriptError struct{}
+
+// ConfusableError indicates that an internationalized label could be
+// mistaken for a Latin one.
+type ConfusableError struct{}
+
+func (e InvalidIDNError) Error() string       { return "Invalid internationalized domain name" }
+func (e DisallowedScriptError) Error() string { return "Name uses a script that is not allowed" }
+func (e MixedScriptError) Error() string      { return "Name mixes scripts" }
+func (e ConfusableError) Error() string       { return "Name is confusable with a Latin name" }
+
+const acePrefix = "xn--"
+
+// ToUnicode converts each A-label in a name to its U-label, leaving other
+// labels, and A-labels that cannot be decoded, unchanged.
+func ToUnicode(name string) string {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), acePrefix) {
+			continue
+		}
+		if decoded, err := punycodeDecode(label[len(acePrefix):]); err == nil && len(decoded) > 0 {
+			labels[i] = string(decoded)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// checkIDNLabel validates a lower-cased A-label and applies the IDN policy
+// to its U-label.
+//
+// Labels MUST round-trip between the A-label and U-label forms, and the
+// U-label:
+//
+//  * MUST contain at least one non-ASCII character
+//  * MUST contain only lower-case letters, combining marks, digits and
+//    hyphens
+//  * MUST NOT contain deprecated characters, or Latin modifier letters,
+//    which are superscript forms of other letters
+//  * MUST NOT begin with a combining mark, or have a combining mark follow
+//    a Latin, Greek or Cyrillic letter, since those scripts are written
+//    with precomposed letters
+//  * MUST NOT begin or end with a hyphen, or have hyphens in both the third
+//    and fourth positions
+//
+// This covers the IDNA2008 rules that can be checked with the tables in the
+// unicode package, and is stricter where those tables fall short: instead
+// of checking NFC, it refuses decomposed letters in the scripts that have
+// precomposed ones. The contextual rules are not implemented.
+func (idn IDNPolicy) checkIDNLabel(label string) error {
+	ulabel, err := punycodeDecode(label[len(acePrefix):])
+	if err != nil {
+		return InvalidIDNError{}
+	}
+	if encoded, err := punycodeEncode(ulabel); err != nil || acePrefix+encoded != label {
+		return InvalidIDNError{}
+	}
+
+	if len(ulabel) == 0 || ulabel[0] == '-' || ulabel[len(ulabel)-1] == '-' ||
+		(len(ulabel) >= 4 && ulabel[2] == '-' && ulabel[3] == '-') {
+		return InvalidIDNError{}
+	}
+	if unicode.In(ulabel[0], unicode.M) {
+		return InvalidIDNError{}
+	}
+	nonASCII := false
+	for i, r := range ulabel {
+		if r >= utf8.RuneSelf {
+			nonASCII = true
+		}
+		if r != '-' && !unicode.In(r, unicode.Ll, unicode.Lo, unicode.Lm, unicode.Mn, unicode.Mc, unicode.Nd) {
+			return InvalidIDNError{}
+		}
+		if unicode.Is(unicode.Deprecated, r) || (unicode.Is(unicode.Lm, r) && unicode.Is(unicode.Latin, r)) {
+			return InvalidIDNError{}
+		}
+		if i > 0 && unicode.Is(unicode.Mn, r) && unicode.In(ulabel[i-1], unicode.Latin, unicode.Greek, unicode.Cyrillic) {
+			return InvalidIDNError{}
+		}
+	}
+	if !nonASCII {
+		return InvalidIDNError{}
+	}
+
+	scripts := labelScripts(ulabel)
+	if len(idn.AllowedScripts) > 0 {
+		allowed := make(map[string]bool, len(idn.AllowedScripts))
+		for _, script := range idn.AllowedScripts {
+			allowed[script] = true
+		}
+		for script := range scripts {
+			if !allowed[script] {
+				return DisallowedScriptError{}
+			}
+		}
+	}
+	if !idn.AllowMixedScript && len(scripts) > 1 && !highlyRestrictive(scripts) {
+		return MixedScriptError{}
+	}
+	if !idn.AllowConfusables && latinConfusable(ulabel, scripts) {
+		return ConfusableError{}
+	}
+	return nil
+}
+
+// labelScripts returns the set of scripts used by a label, ignoring the
+// Common and Inherited pseudo-scripts shared by all of them.
+func labelScripts(label []rune) map[string]bool {
+	scripts := make(map[string]bool)
+	for _, r := range label {
+		if unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+		for name, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				scripts[name] = true
+				break
+			}
+		}
+	}
+	return scripts
+}
+
+// Script combinations allowed at the UTS #39 "Highly Restrictive" level.
+var highlyRestrictiveSets = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+func highlyRestrictive(scripts map[string]bool) bool {
+	for _, set := range highlyRestrictiveSets {
+		covered := true
+		for script := range scripts {
+			if !set[script] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// Cyrillic and Greek letters that are commonly rendered like Latin ones.
+var latinLookalikes = map[rune]bool{
+	// Cyrillic
+	'а': true, 'г': true, 'е': true, 'һ': true, 'і': true, 'ј': true,
+	'к': true, 'ӏ': true, 'о': true, 'р': true, 'с': true, 'ԁ': true,
+	'ԛ': true, 'ѕ': true, 'у': true, 'ԝ': true, 'х': true, 'ү': true,
+	// Greek
+	'α': true, 'ι': true, 'κ': true, 'ν': true, 'ο': true, 'ρ': true,
+	'τ': true, 'υ': true,
+}
+
+// latinConfusable returns true if a single-script Cyrillic or Greek label
+// consists only of letters that look like Latin letters, so that the whole
+// label can pass for a Latin one.
+func latinConfusable(label []rune, scripts map[string]bool) bool {
+	if len(scripts) != 1 || !(scripts["Cyrillic"] || scripts["Greek"]) {
+		return false
+	}
+	for _, r := range label {
+		if unicode.IsLetter(r) && !latinLookalikes[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode (RFC 3492) parameters
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+var errPunycode = errors.New("Invalid punycode")
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyDecodeDigit(c byte) (int, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 26, true
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a'), true
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A'), true
+	}
+	return 0, false
+}
+
+func punyEncodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punycodeDecode decodes the part of an A-label following "xn--".
+func punycodeDecode(input string) ([]rune, error) {
+	var output []rune
+	start := 0
+	if b := strings.LastIndex(input, "-"); b >= 0 {
+		for i := 0; i < b; i++ {
+			if input[i] >= utf8.RuneSelf {
+				return nil, errPunycode
+			}
+			output = append(output, rune(input[i]))
+		}
+		start = b + 1
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for in := start; in < len(input); {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if in >= len(input) {
+				return nil, errPunycode
+			}
+			digit, ok := punyDecodeDigit(input[in])
+			in++
+			if !ok || digit > (math.MaxInt32-i)/w {
+				return nil, errPunycode
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > math.MaxInt32/(punyBase-t) {
+				return nil, errPunycode
+			}
+			w *= punyBase - t
+		}
+		length := len(output) + 1
+		bias = punyAdapt(i-oldi, length, oldi == 0)
+		if i/length > math.MaxInt32-n {
+			return nil, errPunycode
+		}
+		n += i / length
+		i %= length
+		if n > unicode.MaxRune {
+			return nil, errPunycode
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return output, nil
+}
+
+// punycodeEncode encodes a U-label into the part of an A-label following
+// "xn--".
+func punycodeEncode(input []rune) (string, error) {
+	var output []byte
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+	h := len(output)
+	b := h
+	if b > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for h < len(input) {
+		m := math.MaxInt32
+		for _, r := range input {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if m-n > (math.MaxInt32-delta)/(h+1) {
+			return "", errPunycode
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if int(r) < n {
+				delta++
+				if delta == math.MaxInt32 {
+					return "", errPunycode
+				}
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				output = append(output, punyEncodeDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyEncodeDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
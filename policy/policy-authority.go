@@ -6,6 +6,7 @@
 package policy
 
 import (
+	"fmt"
 	"net"
 	"regexp"
 	"strings"
@@ -20,6 +21,10 @@ type PolicyAuthorityImpl struct {
 
 	PublicSuffixList map[string]bool // A copy of the DNS root zone
 	Blacklist        map[string]bool // A blacklist of denied names
+	HighRisk         map[string]bool // Names in the "high" risk tier
+	IDN              IDNPolicy       // Which internationalized names to accept
+
+	challengeRules *challengeRuleSet
 }
 
 // NewPolicyAuthorityImpl constructs a Policy Authority.
@@ -27,7 +32,10 @@ func NewPolicyAuthorityImpl() *PolicyAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Policy Authority Starting")
 
-	pa := PolicyAuthorityImpl{log: logger}
+	pa := PolicyAuthorityImpl{
+		log:            logger,
+		challengeRules: &challengeRuleSet{rules: defaultChallengeRules},
+	}
 
 	// TODO: Add configurability
 	pa.PublicSuffixList = PublicSuffixList
@@ -38,6 +46,45 @@ func NewPolicyAuthorityImpl() *PolicyAuthorityImpl {
 
 const maxLabels = 10
 
+const wildcardPrefix = "*."
+
+// IsWildcard returns true if the name requests a wildcard certificate, i.e.
+// its leftmost label is "*".
+func IsWildcard(name string) bool {
+	return strings.HasPrefix(name, wildcardPrefix)
+}
+
+// WildcardBase returns the name a wildcard covers, e.g. "example.com" for
+// "*.example.com". Other names are returned unchanged.
+func WildcardBase(name string) string {
+	if IsWildcard(name) {
+		return name[len(wildcardPrefix):]
+	}
+	return name
+}
+
+// RegisteredDomain returns the domain a name was registered under, i.e. the
+// name's public suffix and the label to the left of it, e.g. "example.co.uk"
+// for "www.example.co.uk". It returns an error if the name is itself a
+// public suffix.
+func RegisteredDomain(name string) (string, error) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(WildcardBase(name), ".")), ".")
+	for i := range labels {
+		if PublicSuffixList[strings.Join(labels[i:], ".")] {
+			if i == 0 {
+				return "", fmt.Errorf("%s is a public suffix", name)
+			}
+			return strings.Join(labels[i-1:], "."), nil
+		}
+	}
+	if len(labels) > 1 {
+		// Names under a TLD missing from the list are registered directly
+		// under it
+		return strings.Join(labels[len(labels)-2:], "."), nil
+	}
+	return "", fmt.Errorf("%s is a public suffix", name)
+}
+
 var dnsLabelRegexp = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9-]{0,62}$")
 var punycodeRegexp = regexp.MustCompile("^xn--")
 
@@ -76,23 +123,39 @@ type NonPublicError struct{}
 // BlacklistedError indicates we have blacklisted one or more of these identifiers.
 type BlacklistedError struct{}
 
+// ReservedIPError indicates that an IP address identifier was in a range that
+// is not globally routable.
+type ReservedIPError struct{}
+
 func (e InvalidIdentifierError) Error() string { return "Invalid identifier type" }
 func (e SyntaxError) Error() string            { return "Syntax error" }
 func (e NonPublicError) Error() string         { return "Name does not end in a public suffix" }
 func (e BlacklistedError) Error() string       { return "Name is blacklisted" }
+func (e ReservedIPError) Error() string        { return "IP address is in a reserved range" }
 
 // WillingToIssue determines whether the CA is willing to issue for the provided
 // identifier.
 //
 // We place several criteria on identifiers we are willing to issue for:
 //
-//  * MUST self-identify as DNS identifiers
+//  * MUST self-identify as DNS or IP identifiers
+//
+// For IP identifiers, the value:
+//
+//  * MUST be an IPv4 or IPv6 address in its canonical text form
+//  * MUST NOT be in a reserved range (see reservedNetworks)
+//
+// For DNS identifiers, the name:
+//
+//  * MAY begin with a single "*." wildcard label, in which case the
+//    remaining criteria apply to the rest of the name
 //  * MUST contain only bytes in the DNS hostname character set
 //  * MUST NOT have more than maxLabels labels
 //  * MUST follow the DNS hostname syntax rules in RFC 1035 and RFC 2181
 //    In particular:
 //    * MUST NOT contain underscores
-//  * MUST NOT contain IDN labels (xn--)
+//  * MUST NOT contain IDN labels (xn--) unless they are valid IDNA2008
+//    A-labels that satisfy the IDN policy (see checkIDNLabel)
 //  * MUST NOT match the syntax of an IP address
 //  * MUST end in a public suffix
 //  * MUST have at least one label in addition to the public suffix
@@ -105,10 +168,14 @@ func (e BlacklistedError) Error() string       { return "Name is blacklisted" }
 //
 // XXX: We should probably fold everything to lower-case somehow.
 func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier) error {
-	if id.Type != core.IdentifierDNS {
+	switch id.Type {
+	case core.IdentifierDNS:
+	case core.IdentifierIP:
+		return willingToIssueIP(id.Value)
+	default:
 		return InvalidIdentifierError{}
 	}
-	domain := id.Value
+	domain := WildcardBase(id.Value)
 
 	for _, ch := range []byte(domain) {
 		if !isDNSCharacter(ch) {
@@ -141,11 +208,17 @@ func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier) error {
 		}
 
 		if punycodeRegexp.MatchString(label) {
-			return SyntaxError{}
+			if err := pa.IDN.checkIDNLabel(label); err != nil {
+				// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+				pa.log.Audit(fmt.Sprintf("Rejected internationalized name %s [%s]: %s", domain, ToUnicode(domain), err))
+				return err
+			}
 		}
 	}
 
-	// Require match to PSL, plus at least one label
+	// Require match to PSL, plus at least one label. This and the blacklist
+	// comparison work on the lower-cased A-labels, whose canonical encoding
+	// is enforced by checkIDNLabel.
 	if !suffixMatch(labels, pa.PublicSuffixList, true) {
 		return NonPublicError{}
 	}
@@ -158,20 +231,87 @@ func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier) error {
 	return nil
 }
 
+func willingToIssueIP(value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil || ip.String() != value {
+		return SyntaxError{}
+	}
+	if isReservedIP(ip) {
+		return ReservedIPError{}
+	}
+	return nil
+}
+
+// ChallengeTypeEnabled returns true if the challenge type is one the PA
+// knows and the challenge rules have not disabled it. Challenges of disabled
+// types must not be validated, even if they were offered before the type
+// was disabled.
+func (pa PolicyAuthorityImpl) ChallengeTypeEnabled(challengeType string) bool {
+	return knownChallengeType(challengeType) && !pa.challengeRules.get().disabled(challengeType)
+}
+
 // ChallengesFor makes a decision of what challenges, and combinations, are
-// acceptable for the given identifier.
-//
-// Note: Current implementation is static, but future versions may not be.
-func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier) (challenges []core.Challenge, combinations [][]int) {
-	challenges = []core.Challenge{
-		core.SimpleHTTPChallenge(),
-		core.DvsniChallenge(),
-		core.DNSChallenge(),
-	}
-	combinations = [][]int{
-		[]int{0},
-		[]int{1},
-		[]int{2},
+// acceptable for the given identifier when requested by the given
+// registration. The first of the challenge rules that matches decides, but
+// disabled challenge types are never offered, wildcard names can only be
+// validated through DNS, and IP addresses cannot be validated through DNS at
+// all. If no combination survives, no challenges are returned.
+func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier, regID int64) (challenges []core.Challenge, combinations [][]int) {
+	rules := pa.challengeRules.get()
+	tier := ""
+	if identifier.Type == core.IdentifierDNS {
+		tier = pa.riskTier(identifier.Value, rules)
+	}
+
+	wildcard := IsWildcard(identifier.Value)
+	usable := func(challengeType string) bool {
+		switch {
+		case rules.disabled(challengeType):
+			return false
+		case wildcard:
+			return dnsChallengeTypes[challengeType]
+		case identifier.Type == core.IdentifierIP:
+			return !dnsChallengeTypes[challengeType]
+		}
+		return true
+	}
+
+	for _, rule := range rules.Rules {
+		if !rule.matches(identifier, regID, tier) {
+			continue
+		}
+
+		var typeCombinations [][]string
+		offered := make(map[string]bool)
+	nextCombination:
+		for _, typeCombination := range rule.Combinations {
+			for _, challengeType := range typeCombination {
+				if !usable(challengeType) {
+					continue nextCombination
+				}
+			}
+			typeCombinations = append(typeCombinations, typeCombination)
+			for _, challengeType := range typeCombination {
+				offered[challengeType] = true
+			}
+		}
+
+		// Offer each challenge type once
+		index := make(map[string]int)
+		for _, challengeType := range challengeTypes {
+			if offered[challengeType.Type] {
+				index[challengeType.Type] = len(challenges)
+				challenges = append(challenges, challengeType.New())
+			}
+		}
+		for _, typeCombination := range typeCombinations {
+			var combination []int
+			for _, challengeType := range typeCombination {
+				combination = append(combination, index[challengeType])
+			}
+			combinations = append(combinations, combination)
+		}
+		return
 	}
 	return
 }
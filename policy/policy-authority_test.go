@@ -10,6 +10,7 @@ import (
 
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
 )
 
 var log = mocks.UseMockLog()
@@ -32,17 +33,18 @@ func TestWillingToIssue(t *testing.T) {
 
 		`www.abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz.com`, // Label too long (>63 characters)
 
-		`www.-ombo.com`,   // Label starts with '-'
-		`www.xn--hmr.net`, // Punycode (disallowed for now)
-		`xn--.net`,        // No punycode for now.
+		`www.-ombo.com`, // Label starts with '-'
 		`0`,
 		`1`,
 		`*`,
 		`**`,
 		`*.*`,
 		`zombo*com`,
+		`*.*.zombo.com`,   // Only a single wildcard label
+		`www.*.zombo.com`, // Wildcard must be leftmost
+		`*zombo.com`,
 		`*.com`,
-		`*.zombo.com`,
+		`*.`,
 		`.`,
 		`..`,
 		`a..`,
@@ -66,6 +68,7 @@ func TestWillingToIssue(t *testing.T) {
 
 	shouldBeNonPublic := []string{
 		`co.uk`,
+		`*.co.uk`,
 		`example.acting`,
 		`example.internal`,
 		// All-numeric final label not okay.
@@ -77,6 +80,7 @@ func TestWillingToIssue(t *testing.T) {
 		`ebay.co.uk`,
 		`www.google.com`,
 		`lots.of.labels.pornhub.com`,
+		`*.google.com`,
 	}
 
 	shouldBeAccepted := []string{
@@ -88,12 +92,14 @@ func TestWillingToIssue(t *testing.T) {
 		"zombo-.com",
 		"www.zom-bo.com",
 		"www.zombo-.com",
+		"*.zombo.com",
+		"*.www.zombo.com",
 	}
 
 	pa := NewPolicyAuthorityImpl()
 
 	// Test for invalid identifier type
-	identifier := core.AcmeIdentifier{Type: "ip", Value: "example.com"}
+	identifier := core.AcmeIdentifier{Type: "email", Value: "example.com"}
 	err := pa.WillingToIssue(identifier)
 	_, ok := err.(InvalidIdentifierError)
 	if !ok {
@@ -139,17 +145,247 @@ func TestWillingToIssue(t *testing.T) {
 	}
 }
 
+func TestWillingToIssueIP(t *testing.T) {
+	shouldBeSyntaxError := []string{
+		``,
+		`example.com`,
+		`256.0.0.1`,
+		`8.8.8.8/32`,
+		`[2606:4700::1]`,
+		`2606:4700:0:0::1`, // Not in canonical form
+		`::ffff:8.8.8.8`,   // IPv4-mapped, canonically 8.8.8.8
+	}
+
+	shouldBeReserved := []string{
+		`0.0.0.0`,
+		`10.1.2.3`,
+		`127.0.0.1`,
+		`169.254.169.254`,
+		`172.16.0.1`,
+		`192.168.1.1`,
+		`192.0.2.1`,
+		`224.0.0.1`,
+		`255.255.255.255`,
+		`::`,
+		`::1`,
+		`2001:db8::1`,
+		`fc00::1`,
+		`fe80::1`,
+		`ff02::1`,
+	}
+
+	shouldBeAccepted := []string{
+		`8.8.8.8`,
+		`93.184.216.34`,
+		`2606:4700::1`,
+	}
+
+	pa := NewPolicyAuthorityImpl()
+
+	for _, ip := range shouldBeSyntaxError {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip}
+		err := pa.WillingToIssue(identifier)
+		if _, ok := err.(SyntaxError); !ok {
+			t.Error("Identifier was not correctly forbidden: ", identifier, err)
+		}
+	}
+
+	for _, ip := range shouldBeReserved {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip}
+		err := pa.WillingToIssue(identifier)
+		if _, ok := err.(ReservedIPError); !ok {
+			t.Error("Identifier was not correctly forbidden: ", identifier, err)
+		}
+	}
+
+	for _, ip := range shouldBeAccepted {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip}
+		if err := pa.WillingToIssue(identifier); err != nil {
+			t.Error("Identifier was incorrectly forbidden: ", identifier, err)
+		}
+	}
+}
+
+func TestWillingToIssueIDN(t *testing.T) {
+	testCases := []struct {
+		domain   string
+		expected error
+	}{
+		{`xn--bcher-kva.com`, nil},                 // bücher
+		{`www.xn--mnchen-3ya.de`, nil},             // münchen
+		{`www.xn--hmr.net`, nil},                   // Han
+		{`xn--e1afmkfd.com`, nil},                  // пример
+		{`xn--jxalpdlp.com`, nil},                  // δοκιμή
+		{`xn--eckwd4c7cu47r2wf.jp`, nil},           // Katakana and Han
+		{`xn--test-uk4cni7fufy050ayoj.jp`, nil},    // Katakana, Han and Latin
+		{`*.xn--bcher-kva.com`, nil},               // Wildcard
+		{`XN--BCHER-KVA.com`, nil},                 // Upper case A-label
+		{`xn--.net`, InvalidIDNError{}},            // Empty
+		{`xn--abc-.com`, InvalidIDNError{}},        // No non-ASCII characters
+		{`xn--bcher--3ya.com`, InvalidIDNError{}},  // U-label ends with a hyphen
+		{`xn--ab---3ra.com`, InvalidIDNError{}},    // Hyphens in third and fourth positions
+		{`xn--zz9999999.com`, InvalidIDNError{}},   // Overflow
+		{`xn--ab-ira.com`, InvalidIDNError{}},      // U+0149 is deprecated
+		{`xn--ab-bnb.com`, InvalidIDNError{}},      // Superscript modifier letter U+02B0
+		{`xn--example-tge.com`, InvalidIDNError{}}, // e followed by a combining acute accent
+		{`xn--BCHER-KVA.com`, nil},                 // Lower-cased before checking
+		{`xn--pypal-4ve.com`, MixedScriptError{}},  // Latin and Cyrillic
+		{`xn--mxa0x.com`, MixedScriptError{}},      // Greek and Cyrillic
+		{`xn--test-kld9a9aht1a.com`, MixedScriptError{}},
+		{`xn--80ak6aa92e.com`, ConfusableError{}}, // аррӏе
+		{`xn--0xa.com`, ConfusableError{}},        // ο
+	}
+
+	pa := NewPolicyAuthorityImpl()
+	for _, tc := range testCases {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: tc.domain}
+		err := pa.WillingToIssue(identifier)
+		if err != tc.expected {
+			t.Errorf("WillingToIssue(%s): expected [%v], got [%v]", tc.domain, tc.expected, err)
+		}
+	}
+
+	// Relaxing the policy accepts mixed scripts and confusables
+	pa.IDN = IDNPolicy{AllowMixedScript: true, AllowConfusables: true}
+	for _, domain := range []string{`xn--pypal-4ve.com`, `xn--80ak6aa92e.com`} {
+		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
+		if err := pa.WillingToIssue(identifier); err != nil {
+			t.Errorf("WillingToIssue(%s) under relaxed policy: %s", domain, err)
+		}
+	}
+
+	// Restricting scripts
+	pa.IDN = IDNPolicy{AllowedScripts: []string{"Latin"}}
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: `xn--bcher-kva.com`}
+	if err := pa.WillingToIssue(identifier); err != nil {
+		t.Error("Identifier in allowed script was forbidden: ", identifier, err)
+	}
+	identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: `xn--e1afmkfd.com`}
+	if _, ok := pa.WillingToIssue(identifier).(DisallowedScriptError); !ok {
+		t.Error("Identifier in disallowed script was not forbidden: ", identifier)
+	}
+
+	// The blacklist is matched against A-labels
+	pa.IDN = IDNPolicy{}
+	pa.Blacklist = map[string]bool{"xn--bcher-kva.com": true}
+	identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: `www.xn--bcher-kva.com`}
+	if _, ok := pa.WillingToIssue(identifier).(BlacklistedError); !ok {
+		t.Error("Internationalized identifier was not blacklisted: ", identifier)
+	}
+}
+
+func TestPunycode(t *testing.T) {
+	testCases := []struct {
+		ulabel, alabel string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"日本語", "wgv71a119e"},
+		{"ドメイン名例", "eckwd4c7cu47r2wf"},
+		{"例えばtest", "test-p63c6it40r"},
+		{"παράδειγμα", "hxajbheg2az3al"},
+	}
+	for _, tc := range testCases {
+		encoded, err := punycodeEncode([]rune(tc.ulabel))
+		test.AssertNotError(t, err, "Failed to encode")
+		test.AssertEquals(t, encoded, tc.alabel)
+		decoded, err := punycodeDecode(tc.alabel)
+		test.AssertNotError(t, err, "Failed to decode")
+		test.AssertEquals(t, string(decoded), tc.ulabel)
+	}
+
+	test.AssertEquals(t, ToUnicode("www.xn--bcher-kva.com"), "www.bücher.com")
+	test.AssertEquals(t, ToUnicode("www.xn--.com"), "www.xn--.com")
+	test.AssertEquals(t, ToUnicode("www.xn--zz9999999.com"), "www.xn--zz9999999.com")
+}
+
 func TestChallengesFor(t *testing.T) {
 	pa := NewPolicyAuthorityImpl()
 
-	challenges, combinations := pa.ChallengesFor(core.AcmeIdentifier{})
+	challenges, combinations := pa.ChallengesFor(core.AcmeIdentifier{}, 1)
 
-	if len(challenges) != 3 || challenges[0].Type != core.ChallengeTypeSimpleHTTP ||
+	if len(challenges) != 6 || challenges[0].Type != core.ChallengeTypeSimpleHTTP ||
 		challenges[1].Type != core.ChallengeTypeDVSNI ||
-		challenges[2].Type != core.ChallengeTypeDNS {
+		challenges[2].Type != core.ChallengeTypeDNS ||
+		challenges[3].Type != core.ChallengeTypeHTTP01 ||
+		challenges[4].Type != core.ChallengeTypeDNS01 ||
+		challenges[5].Type != core.ChallengeTypeTLSALPN01 {
 		t.Error("Incorrect challenges returned")
 	}
-	if len(combinations) != 3 || combinations[0][0] != 0 || combinations[1][0] != 1 {
+	if len(combinations) != 6 || combinations[0][0] != 0 || combinations[1][0] != 1 || combinations[3][0] != 3 ||
+		combinations[4][0] != 4 || combinations[5][0] != 5 {
 		t.Error("Incorrect combinations returned")
 	}
+
+	// Wildcards may only be validated through DNS
+	challenges, combinations = pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "*.zombo.com"}, 1)
+	if len(challenges) != 2 || challenges[0].Type != core.ChallengeTypeDNS ||
+		challenges[1].Type != core.ChallengeTypeDNS01 {
+		t.Error("Incorrect challenges returned for wildcard")
+	}
+	if len(combinations) != 2 || len(combinations[0]) != 1 || combinations[0][0] != 0 ||
+		len(combinations[1]) != 1 || combinations[1][0] != 1 {
+		t.Error("Incorrect combinations returned for wildcard")
+	}
+
+	// High risk names need DNS as well as one of the other challenges
+	pa.HighRisk = map[string]bool{"zombo.com": true}
+	challenges, combinations = pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "www.zombo.com"}, 1)
+	if len(challenges) != 6 {
+		t.Error("Incorrect challenges returned for high risk name")
+	}
+	if len(combinations) != 6 || len(combinations[0]) != 2 || combinations[0][0] != 0 || combinations[0][1] != 2 ||
+		len(combinations[1]) != 2 || combinations[1][0] != 1 || combinations[1][1] != 2 ||
+		len(combinations[2]) != 2 || combinations[2][0] != 3 || combinations[2][1] != 2 ||
+		len(combinations[3]) != 2 || combinations[3][0] != 3 || combinations[3][1] != 4 ||
+		len(combinations[4]) != 2 || combinations[4][0] != 5 || combinations[4][1] != 2 ||
+		len(combinations[5]) != 2 || combinations[5][0] != 5 || combinations[5][1] != 4 {
+		t.Error("Incorrect combinations returned for high risk name")
+	}
+
+	// IP addresses have no DNS challenge
+	challenges, combinations = pa.ChallengesFor(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "8.8.8.8"}, 1)
+	if len(challenges) != 3 || challenges[0].Type != core.ChallengeTypeSimpleHTTP ||
+		challenges[1].Type != core.ChallengeTypeDVSNI ||
+		challenges[2].Type != core.ChallengeTypeHTTP01 {
+		t.Error("Incorrect challenges returned for IP address")
+	}
+	if len(combinations) != 3 || combinations[0][0] != 0 || combinations[1][0] != 1 || combinations[2][0] != 2 {
+		t.Error("Incorrect combinations returned for IP address")
+	}
+}
+
+func TestRegisteredDomain(t *testing.T) {
+	domains := map[string]string{
+		"zombo.com":             "zombo.com",
+		"www.zombo.com":         "zombo.com",
+		"*.www.zombo.com":       "zombo.com",
+		"WWW.Zombo.co.uk":       "zombo.co.uk",
+		"www.zombo.appspot.com": "zombo.appspot.com",
+	}
+	for name, expected := range domains {
+		domain, err := RegisteredDomain(name)
+		if err != nil {
+			t.Errorf("Error finding registered domain of %s: %s", name, err)
+		} else if domain != expected {
+			t.Errorf("Incorrect registered domain of %s: %s", name, domain)
+		}
+	}
+	for _, name := range []string{"com", "co.uk"} {
+		if _, err := RegisteredDomain(name); err == nil {
+			t.Errorf("Found registered domain of public suffix %s", name)
+		}
+	}
+}
+
+func TestWildcardBase(t *testing.T) {
+	if !IsWildcard("*.zombo.com") || IsWildcard("www.zombo.com") {
+		t.Error("Wildcard names not correctly identified")
+	}
+	if base := WildcardBase("*.zombo.com"); base != "zombo.com" {
+		t.Errorf("Incorrect wildcard base: %s", base)
+	}
+	if base := WildcardBase("www.zombo.com"); base != "www.zombo.com" {
+		t.Errorf("Non-wildcard name changed: %s", base)
+	}
 }
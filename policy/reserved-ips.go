@@ -0,0 +1,70 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package policy
+
+import (
+	"net"
+)
+
+var reservedNetworks = parseNetworks([]string{
+	// Special purpose IPv4 addresses
+	// http://www.iana.org/assignments/iana-ipv4-special-registry/iana-ipv4-special-registry.xhtml
+	"0.0.0.0/8",          // "This host on this network"
+	"10.0.0.0/8",         // Private-Use
+	"100.64.0.0/10",      // Shared Address Space
+	"127.0.0.0/8",        // Loopback
+	"169.254.0.0/16",     // Link Local
+	"172.16.0.0/12",      // Private-Use
+	"192.0.0.0/24",       // IETF Protocol Assignments
+	"192.0.2.0/24",       // Documentation (TEST-NET-1)
+	"192.88.99.0/24",     // 6to4 Relay Anycast
+	"192.168.0.0/16",     // Private-Use
+	"198.18.0.0/15",      // Benchmarking
+	"198.51.100.0/24",    // Documentation (TEST-NET-2)
+	"203.0.113.0/24",     // Documentation (TEST-NET-3)
+	"224.0.0.0/4",        // Multicast
+	"240.0.0.0/4",        // Reserved
+	"255.255.255.255/32", // Limited Broadcast
+
+	// Special purpose IPv6 addresses
+	// http://www.iana.org/assignments/iana-ipv6-special-registry/iana-ipv6-special-registry.xhtml
+	// IPv4-mapped addresses (::ffff:0:0/96) are left out, since net.IPNet
+	// treats that network as covering all of IPv4. They are never in
+	// canonical form, so WillingToIssue rejects them anyway.
+	"::/128",        // Unspecified Address
+	"::1/128",       // Loopback Address
+	"64:ff9b::/96",  // IPv4-IPv6 Translation
+	"100::/64",      // Discard-Only Address Block
+	"2001::/23",     // IETF Protocol Assignments
+	"2001:db8::/32", // Documentation
+	"2002::/16",     // 6to4
+	"fc00::/7",      // Unique-Local
+	"fe80::/10",     // Link-Local Unicast
+	"ff00::/8",      // Multicast
+})
+
+func parseNetworks(cidrs []string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// isReservedIP returns true if the address falls in a range that is not
+// globally routable.
+func isReservedIP(ip net.IP) bool {
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
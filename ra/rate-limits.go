@@ -0,0 +1,89 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// RateLimitPolicy limits an activity to Threshold occurrences per Window.
+// Overrides replace the threshold for particular keys, such as registered
+// domains. A policy with no threshold is disabled.
+type RateLimitPolicy struct {
+	Window    time.Duration
+	Threshold int
+	Overrides map[string]int
+}
+
+// Enabled returns true if the policy limits anything.
+func (p RateLimitPolicy) Enabled() bool {
+	return p.Threshold > 0
+}
+
+// GetThreshold returns the threshold for a key, taking overrides into
+// account.
+func (p RateLimitPolicy) GetThreshold(key string) int {
+	if threshold, present := p.Overrides[key]; present {
+		return threshold
+	}
+	return p.Threshold
+}
+
+// UnmarshalJSON reads a policy whose window is a duration string such as
+// "168h".
+func (p *RateLimitPolicy) UnmarshalJSON(data []byte) (err error) {
+	var raw struct {
+		Window    string
+		Threshold int
+		Overrides map[string]int
+	}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+	if raw.Window != "" {
+		if p.Window, err = time.ParseDuration(raw.Window); err != nil {
+			return
+		}
+	}
+	p.Threshold = raw.Threshold
+	p.Overrides = raw.Overrides
+	return
+}
+
+// RateLimitPolicies holds the limits the RA applies to registrations,
+// authorizations and certificate issuance.
+type RateLimitPolicies struct {
+	// Certificates issued for names under each registered domain
+	CertificatesPerName RateLimitPolicy
+
+	// Certificates issued for exactly the same set of names
+	CertificatesPerFQDNSet RateLimitPolicy
+
+	// Registrations created from each IP address
+	RegistrationsPerIP RateLimitPolicy
+
+	// Pending authorizations each registration may hold at once. The
+	// window is unused.
+	PendingAuthorizationsPerAccount RateLimitPolicy
+
+	// Failed validations of each hostname by each registration
+	InvalidAuthorizationsPerAccount RateLimitPolicy
+}
+
+// LoadRateLimitPolicies reads rate limit policies from a JSON file.
+func LoadRateLimitPolicies(filename string) (policies RateLimitPolicies, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &policies); err != nil {
+		err = fmt.Errorf("Couldn't parse rate limit policies [%s]: %s", filename, err)
+	}
+	return
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/mail"
 	"net/url"
 	"regexp"
@@ -16,6 +17,7 @@ import (
 	"strings"
 	"time"
 
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
@@ -35,6 +37,20 @@ type RegistrationAuthorityImpl struct {
 
 	AuthzBase  string
 	MaxKeySize int
+
+	// How long new authorizations remain pending, and how long they remain
+	// valid once validated.
+	PendingAuthorizationLifetime time.Duration
+	AuthorizationLifetime        time.Duration
+
+	RateLimitPolicies RateLimitPolicies
+
+	// When ReuseAuthorizations is set, NewAuthorization returns a pending
+	// or valid authorization the registration already holds for the
+	// identifier, provided it remains usable for at least
+	// ReuseMinLifetime.
+	ReuseAuthorizations bool
+	ReuseMinLifetime    time.Duration
 }
 
 // NewRegistrationAuthorityImpl constructs a new RA object.
@@ -42,17 +58,50 @@ func NewRegistrationAuthorityImpl() RegistrationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Registration Authority Starting")
 
-	ra := RegistrationAuthorityImpl{log: logger}
+	ra := RegistrationAuthorityImpl{
+		log:                          logger,
+		PendingAuthorizationLifetime: defaultPendingAuthorizationLifetime,
+		AuthorizationLifetime:        defaultAuthorizationLifetime,
+	}
 	ra.PA = policy.NewPolicyAuthorityImpl()
 	return ra
 }
 
+// How long a subscriber has to finalize an order
+const orderLifetime = 7 * 24 * time.Hour
+
+// Authorization lifetimes used unless configured otherwise
+const (
+	defaultPendingAuthorizationLifetime = 7 * 24 * time.Hour
+	defaultAuthorizationLifetime        = 365 * 24 * time.Hour
+)
+
 var allButLastPathSegment = regexp.MustCompile("^.*/")
 
 func lastPathSegment(url core.AcmeURL) string {
 	return allButLastPathSegment.ReplaceAllString(url.Path, "")
 }
 
+// auditName formats a name for the audit log, adding the U-label form of
+// internationalized names.
+func auditName(name string) string {
+	if uname := policy.ToUnicode(name); uname != name {
+		return fmt.Sprintf("%s [%s]", name, uname)
+	}
+	return name
+}
+
+// validatedThroughDNS returns true if the authorization was completed through
+// a valid DNS challenge.
+func validatedThroughDNS(authz core.Authorization) bool {
+	for _, challenge := range authz.Challenges {
+		if policy.IsDNSChallenge(challenge.Type) && challenge.Status == core.StatusValid {
+			return true
+		}
+	}
+	return false
+}
+
 func validateEmail(address string, resolver core.DNSResolver) (err error) {
 	_, err = mail.ParseAddress(address)
 	if err != nil {
@@ -90,19 +139,20 @@ func validateContacts(contacts []core.AcmeURL, resolver core.DNSResolver) (err e
 }
 
 type certificateRequestEvent struct {
-	ID                  string    `json:",omitempty"`
-	Requester           int64     `json:",omitempty"`
-	SerialNumber        string    `json:",omitempty"`
-	RequestMethod       string    `json:",omitempty"`
-	VerificationMethods []string  `json:",omitempty"`
-	VerifiedFields      []string  `json:",omitempty"`
-	CommonName          string    `json:",omitempty"`
-	Names               []string  `json:",omitempty"`
-	NotBefore           time.Time `json:",omitempty"`
-	NotAfter            time.Time `json:",omitempty"`
-	RequestTime         time.Time `json:",omitempty"`
-	ResponseTime        time.Time `json:",omitempty"`
-	Error               string    `json:",omitempty"`
+	ID                  string            `json:",omitempty"`
+	Requester           int64             `json:",omitempty"`
+	SerialNumber        string            `json:",omitempty"`
+	RequestMethod       string            `json:",omitempty"`
+	VerificationMethods []string          `json:",omitempty"`
+	VerifiedFields      []string          `json:",omitempty"`
+	CommonName          string            `json:",omitempty"`
+	Names               []string          `json:",omitempty"`
+	UnicodeNames        map[string]string `json:",omitempty"`
+	NotBefore           time.Time         `json:",omitempty"`
+	NotAfter            time.Time         `json:",omitempty"`
+	RequestTime         time.Time         `json:",omitempty"`
+	ResponseTime        time.Time         `json:",omitempty"`
+	Error               string            `json:",omitempty"`
 }
 
 // NewRegistration constructs a new Registration from a request.
@@ -111,7 +161,9 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 		return core.Registration{}, core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
 	}
 	reg = core.Registration{
-		Key: init.Key,
+		Key:       init.Key,
+		Status:    core.StatusValid,
+		InitialIP: init.InitialIP,
 	}
 	reg.MergeUpdate(init)
 
@@ -120,6 +172,10 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 		return
 	}
 
+	if err = ra.checkRegistrationLimit(reg.InitialIP); err != nil {
+		return core.Registration{}, err
+	}
+
 	// Store the authorization object, then return it
 	reg, err = ra.SA.NewRegistration(reg)
 	if err != nil {
@@ -146,26 +202,55 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		return authz, err
 	}
 
-	// Check CAA records for the requested identifier
-	present, valid, err := ra.VA.CheckCAARecords(identifier)
-	if err != nil {
+	// Check CAA records for the requested identifier before reusing an
+	// authorization, since the records may forbid a wildcard even though they
+	// allowed its base domain. CAA only applies to DNS names.
+	if identifier.Type == core.IdentifierDNS {
+		valid, err := ra.checkCAA(identifier, regID)
+		if err != nil {
+			return authz, err
+		}
+		if !valid {
+			err = errors.New("CAA check for identifier failed")
+			return authz, err
+		}
+	}
+
+	if ra.ReuseAuthorizations {
+		var found bool
+		authz, found, err = ra.existingAuthorization(identifier, regID)
+		if err != nil || found {
+			return authz, err
+		}
+	}
+
+	if err = ra.checkPendingAuthorizationLimit(regID); err != nil {
 		return authz, err
 	}
-	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-	ra.log.Audit(fmt.Sprintf("Checked CAA records for %s, registration ID %d [Present: %t, Valid for issuance: %t]", identifier.Value, regID, present, valid))
-	if !valid {
-		err = errors.New("CAA check for identifier failed")
+	baseIdentifier := core.AcmeIdentifier{Type: identifier.Type, Value: policy.WildcardBase(identifier.Value)}
+	if err = ra.checkInvalidAuthorizationLimit(regID, baseIdentifier); err != nil {
 		return authz, err
 	}
 
 	// Create validations, but we have to update them with URIs later
-	challenges, combinations := ra.PA.ChallengesFor(identifier)
+	challenges, combinations := ra.PA.ChallengesFor(identifier, regID)
+	if len(challenges) == 0 {
+		err = core.UnauthorizedError(fmt.Sprintf("No challenges are available for %s", identifier.Value))
+		return authz, err
+	}
+
+	// A wildcard name is authorized by proving control of the domain it
+	// covers, so the authorization is for the base domain, limited to the
+	// challenges the PA offers for wildcards.
+	identifier.Value = policy.WildcardBase(identifier.Value)
 
 	// Partially-filled object
+	expires := time.Now().Add(ra.PendingAuthorizationLifetime)
 	authz = core.Authorization{
 		Identifier:     identifier,
 		RegistrationID: regID,
 		Status:         core.StatusPending,
+		Expires:        &expires,
 		Combinations:   combinations,
 	}
 
@@ -205,8 +290,158 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 	return authz, err
 }
 
+// checkCAA checks whether the CAA records for identifier allow issuance. For
+// a wildcard name the issuewild records apply.
+func (ra *RegistrationAuthorityImpl) checkCAA(identifier core.AcmeIdentifier, regID int64) (valid bool, err error) {
+	present, valid, err := ra.VA.CheckCAARecords(identifier)
+	if err != nil {
+		return false, err
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.Audit(fmt.Sprintf("Checked CAA records for %s, registration ID %d [Present: %t, Valid for issuance: %t]", auditName(identifier.Value), regID, present, valid))
+	return valid, nil
+}
+
+// existingAuthorization looks for an authorization the registration already
+// holds that can satisfy a request for identifier. A wildcard request can
+// only reuse an authorization that is, or can only be, validated through DNS,
+// and no request reuses one that needs challenge types that are disabled.
+func (ra *RegistrationAuthorityImpl) existingAuthorization(identifier core.AcmeIdentifier, regID int64) (authz core.Authorization, found bool, err error) {
+	wildcard := policy.IsWildcard(identifier.Value)
+	base := core.AcmeIdentifier{Type: identifier.Type, Value: policy.WildcardBase(identifier.Value)}
+
+	authzs, err := ra.SA.GetAuthorizationsByIdentifier(regID, base, time.Now().Add(ra.ReuseMinLifetime))
+	if err != nil {
+		err = core.InternalServerError(fmt.Sprintf("Unable to look up existing authorizations: %s", err))
+		return
+	}
+	for _, candidate := range authzs {
+		if len(candidate.Challenges) == 0 {
+			// Still being created
+			continue
+		}
+		if wildcard && !onlyDNS(candidate) {
+			continue
+		}
+		if !ra.enabledCombination(candidate) {
+			continue
+		}
+		ra.log.Info(fmt.Sprintf("Reusing %s authorization %s for %s, registration ID %d", candidate.Status, candidate.ID, auditName(identifier.Value), regID))
+		return candidate, true, nil
+	}
+	return
+}
+
+// enabledCombination returns true if one of an authorization's combinations
+// only uses challenge types that are still enabled, and, if the
+// authorization is valid, was the one that validated it.
+func (ra *RegistrationAuthorityImpl) enabledCombination(authz core.Authorization) bool {
+	for _, combo := range authz.Combinations {
+		usable := len(combo) > 0
+		for _, i := range combo {
+			if i < 0 || i >= len(authz.Challenges) || !ra.PA.ChallengeTypeEnabled(authz.Challenges[i].Type) ||
+				(authz.Status == core.StatusValid && authz.Challenges[i].Status != core.StatusValid) {
+				usable = false
+				break
+			}
+		}
+		if usable {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyDNS returns true if an authorization was validated through DNS or, if
+// still pending, offers no other way to validate it.
+func onlyDNS(authz core.Authorization) bool {
+	if authz.Status == core.StatusValid {
+		return validatedThroughDNS(authz)
+	}
+	for _, challenge := range authz.Challenges {
+		if !policy.IsDNSChallenge(challenge.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// authorizationFor picks, from the given authorizations, the one that lasts
+// longest among those that authorize the registration for identifier: valid
+// and unexpired authorizations for the identifier or, for a wildcard, for
+// its base domain, validated through DNS.
+func authorizationFor(identifier core.AcmeIdentifier, regID int64, authzs []core.Authorization, now time.Time) (authz core.Authorization, err error) {
+	name := identifier.Value
+	base := policy.WildcardBase(name)
+	wildcard := policy.IsWildcard(name)
+	found, needDNS := false, false
+	for _, candidate := range authzs {
+		if candidate.RegistrationID != regID || candidate.Identifier.Type != identifier.Type ||
+			!strings.EqualFold(candidate.Identifier.Value, base) || candidate.Status != core.StatusValid ||
+			candidate.Expires == nil || candidate.Expires.Before(now) {
+			continue
+		}
+		// A wildcard additionally requires that control of the base domain
+		// was proven through DNS
+		if wildcard && !validatedThroughDNS(candidate) {
+			needDNS = true
+			continue
+		}
+		if !found || candidate.Expires.After(*authz.Expires) {
+			authz = candidate
+			found = true
+		}
+	}
+
+	switch {
+	case found:
+		return authz, nil
+	case needDNS:
+		err = core.UnauthorizedError(fmt.Sprintf("Wildcard name %s requires an authorization for %s validated through DNS", name, base))
+	default:
+		err = core.UnauthorizedError(fmt.Sprintf("Key not authorized for name %s", name))
+	}
+	return authz, err
+}
+
+// authorizationStatus returns valid if all the challenges in one of an
+// authorization's combinations have been validated, invalid if every
+// combination includes a challenge that failed, and pending otherwise.
+func authorizationStatus(authz core.Authorization) core.AcmeStatus {
+	status := core.StatusInvalid
+	for _, combo := range authz.Combinations {
+		comboStatus := core.StatusValid
+		if len(combo) == 0 {
+			comboStatus = core.StatusInvalid
+		}
+		for _, i := range combo {
+			if i < 0 || i >= len(authz.Challenges) || authz.Challenges[i].Status == core.StatusInvalid {
+				comboStatus = core.StatusInvalid
+				break
+			}
+			if authz.Challenges[i].Status != core.StatusValid {
+				comboStatus = core.StatusPending
+			}
+		}
+		switch comboStatus {
+		case core.StatusValid:
+			return core.StatusValid
+		case core.StatusPending:
+			status = core.StatusPending
+		}
+	}
+	return status
+}
+
 // NewCertificate requests the issuance of a certificate.
 func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest, regID int64) (cert core.Certificate, err error) {
+	return ra.issueCertificate(req, regID, nil)
+}
+
+// issueCertificate issues a certificate for the names in a CSR. Each name
+// must be covered by one of the given authorizations or, if there are none,
+// by any of the registration's unexpired valid authorizations for it.
+func (ra *RegistrationAuthorityImpl) issueCertificate(req core.CertificateRequest, regID int64, authzs []core.Authorization) (cert core.Certificate, err error) {
 	emptyCert := core.Certificate{}
 	var logEventResult string
 
@@ -249,11 +484,26 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	logEvent.CommonName = csr.Subject.CommonName
 	logEvent.Names = csr.DNSNames
 
-	// Validate that authorization key is authorized for all domains
-	names := make([]string, len(csr.DNSNames))
-	copy(names, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		names = append(names, csr.Subject.CommonName)
+	// Validate that authorization key is authorized for all domains and
+	// IP addresses
+	dnsNames, ipAddresses := core.CSRNames(csr)
+	var identifiers []core.AcmeIdentifier
+	for _, name := range dnsNames {
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+	}
+	for _, ip := range ipAddresses {
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip.String()})
+	}
+	names := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		names[i] = identifier.Value
+		// Record the U-label form of internationalized names
+		if uname := policy.ToUnicode(identifier.Value); uname != identifier.Value {
+			if logEvent.UnicodeNames == nil {
+				logEvent.UnicodeNames = make(map[string]string)
+			}
+			logEvent.UnicodeNames[identifier.Value] = uname
+		}
 	}
 
 	if len(names) == 0 {
@@ -281,15 +531,40 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	// Check that each requested name has a valid authorization
 	now := time.Now()
 	earliestExpiry := time.Date(2100, 01, 01, 0, 0, 0, 0, time.UTC)
-	for _, name := range names {
-		authz, err := ra.SA.GetLatestValidAuthorization(registration.ID, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
-		if err != nil || authz.Expires.Before(now) {
-			// unable to find a valid authorization or authz is expired
-			err = core.UnauthorizedError(fmt.Sprintf("Key not authorized for name %s", name))
+	for _, identifier := range identifiers {
+		name := identifier.Value
+		candidates := authzs
+		if candidates == nil {
+			// Wildcard names are covered by an authorization for their base
+			// domain
+			base := core.AcmeIdentifier{Type: identifier.Type, Value: policy.WildcardBase(name)}
+			if candidates, err = ra.SA.GetAuthorizationsByIdentifier(registration.ID, base, now); err != nil {
+				err = core.InternalServerError(fmt.Sprintf("Unable to look up authorizations: %s", err))
+				logEvent.Error = err.Error()
+				return emptyCert, err
+			}
+		}
+		authz, err := authorizationFor(identifier, registration.ID, candidates, now)
+		if err != nil {
 			logEvent.Error = err.Error()
 			return emptyCert, err
 		}
 
+		// The authorization is for the base domain, so the CAA records that
+		// govern wildcard issuance have not been checked yet
+		if policy.IsWildcard(name) {
+			valid, err := ra.checkCAA(identifier, registration.ID)
+			if err != nil {
+				logEvent.Error = err.Error()
+				return emptyCert, err
+			}
+			if !valid {
+				err = core.UnauthorizedError(fmt.Sprintf("CAA records for %s do not allow issuance", name))
+				logEvent.Error = err.Error()
+				return emptyCert, err
+			}
+		}
+
 		if authz.Expires.Before(earliestExpiry) {
 			earliestExpiry = *authz.Expires
 		}
@@ -298,6 +573,11 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	// Mark that we verified the CN and SANs
 	logEvent.VerifiedFields = []string{"subject.commonName", "subjectAltName"}
 
+	if err = ra.checkLimits(dnsNames); err != nil {
+		logEvent.Error = err.Error()
+		return emptyCert, err
+	}
+
 	// Create the certificate and log the result
 	if cert, err = ra.CA.IssueCertificate(*csr, regID, earliestExpiry); err != nil {
 		// While this could be InternalServerError for certain conditions, most
@@ -333,6 +613,354 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	return cert, nil
 }
 
+// checkLimits enforces the issuance rate limits against the DNS names a
+// certificate is requested for.
+func (ra *RegistrationAuthorityImpl) checkLimits(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	limit := ra.RateLimitPolicies.CertificatesPerName
+	if limit.Enabled() {
+		var domains []string
+		seen := make(map[string]bool)
+		for _, name := range names {
+			domain, err := policy.RegisteredDomain(name)
+			if err != nil {
+				return core.MalformedRequestError(err.Error())
+			}
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+
+		now := time.Now()
+		counts, err := ra.SA.CountCertificatesByNames(domains, now.Add(-limit.Window), now)
+		if err != nil {
+			return core.InternalServerError(err.Error())
+		}
+		var limited []string
+		for _, domain := range domains {
+			if counts[domain] >= limit.GetThreshold(domain) {
+				limited = append(limited, domain)
+			}
+		}
+		if len(limited) > 0 {
+			return core.RateLimitedError(fmt.Sprintf("Too many certificates already issued for: %s", strings.Join(limited, ", ")))
+		}
+	}
+
+	limit = ra.RateLimitPolicies.CertificatesPerFQDNSet
+	if limit.Enabled() {
+		count, err := ra.SA.CountFQDNSets(limit.Window, names)
+		if err != nil {
+			return core.InternalServerError(err.Error())
+		}
+		if count >= int64(limit.Threshold) {
+			return core.RateLimitedError(fmt.Sprintf("Too many certificates already issued for exact set of domains: %s", strings.Join(names, ",")))
+		}
+	}
+	return nil
+}
+
+// checkRegistrationLimit enforces the limit on registrations created from
+// an IP address.
+func (ra *RegistrationAuthorityImpl) checkRegistrationLimit(ip net.IP) error {
+	limit := ra.RateLimitPolicies.RegistrationsPerIP
+	if !limit.Enabled() || ip == nil {
+		return nil
+	}
+	now := time.Now()
+	count, err := ra.SA.CountRegistrationsByIP(ip, now.Add(-limit.Window), now)
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+	if count >= limit.GetThreshold(ip.String()) {
+		return core.RateLimitedError("Too many registrations from this IP")
+	}
+	return nil
+}
+
+// checkPendingAuthorizationLimit enforces the limit on the pending
+// authorizations a registration may hold at once.
+func (ra *RegistrationAuthorityImpl) checkPendingAuthorizationLimit(regID int64) error {
+	limit := ra.RateLimitPolicies.PendingAuthorizationsPerAccount
+	if !limit.Enabled() {
+		return nil
+	}
+	count, err := ra.SA.CountPendingAuthorizations(regID)
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+	if count >= limit.GetThreshold(strconv.FormatInt(regID, 10)) {
+		return core.RateLimitedError("Too many currently pending authorizations")
+	}
+	return nil
+}
+
+// checkInvalidAuthorizationLimit enforces the limit on failed validations
+// of an identifier by a registration.
+func (ra *RegistrationAuthorityImpl) checkInvalidAuthorizationLimit(regID int64, identifier core.AcmeIdentifier) error {
+	limit := ra.RateLimitPolicies.InvalidAuthorizationsPerAccount
+	if !limit.Enabled() {
+		return nil
+	}
+	now := time.Now()
+	count, err := ra.SA.CountInvalidAuthorizations(regID, identifier, now.Add(-limit.Window), now)
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+	if count >= limit.GetThreshold(strconv.FormatInt(regID, 10)) {
+		return core.RateLimitedError(fmt.Sprintf("Too many failed authorizations recently for %s", identifier.Value))
+	}
+	return nil
+}
+
+// NewOrder creates an order for a set of identifiers, with a new
+// authorization for each of them.
+func (ra *RegistrationAuthorityImpl) NewOrder(request core.Order, regID int64) (order core.Order, err error) {
+	if regID <= 0 {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", regID))
+		return
+	}
+	if len(request.Identifiers) == 0 {
+		err = core.MalformedRequestError("Order has no identifiers")
+		return
+	}
+
+	expires := time.Now().Add(orderLifetime)
+	order = core.Order{
+		RegistrationID: regID,
+		Status:         core.StatusPending,
+		Expires:        &expires,
+	}
+	seen := make(map[core.AcmeIdentifier]bool)
+	for _, identifier := range request.Identifiers {
+		if identifier.Type == core.IdentifierDNS {
+			identifier.Value = strings.ToLower(identifier.Value)
+		}
+		if seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+
+		var authz core.Authorization
+		authz, err = ra.NewAuthorization(core.Authorization{Identifier: identifier}, regID)
+		if err != nil {
+			return core.Order{}, err
+		}
+		order.Identifiers = append(order.Identifiers, identifier)
+		order.Authorizations = append(order.Authorizations, authz.ID)
+	}
+
+	if order.Status, err = ra.orderStatus(order); err != nil {
+		err = core.InternalServerError(err.Error())
+		return core.Order{}, err
+	}
+
+	order, err = ra.SA.NewOrder(order)
+	if err != nil {
+		// InternalServerError since the user-data was validated before being
+		// passed to the SA.
+		err = core.InternalServerError(fmt.Sprintf("Invalid order request: %s", err))
+		return core.Order{}, err
+	}
+	return order, nil
+}
+
+// FinalizeOrder issues the certificate for a ready order, from a CSR that
+// requests exactly the order's identifiers. The order is moved from ready to
+// processing first, and only the request that makes that change goes on to
+// issue, so concurrent requests can't issue twice. The order then records the
+// outcome: valid with the certificate's serial, invalid with the problem that
+// stopped issuance, or ready again if issuance failed for reasons of our own,
+// so that it can be retried.
+func (ra *RegistrationAuthorityImpl) FinalizeOrder(order core.Order, req core.CertificateRequest, regID int64) (core.Order, error) {
+	if regID <= 0 || order.RegistrationID != regID {
+		return order, core.UnauthorizedError("Order belongs to another registration")
+	}
+
+	status, err := ra.orderStatus(order)
+	if err != nil {
+		return order, core.InternalServerError(err.Error())
+	}
+	if status != order.Status {
+		previous := order.Status
+		order.Status = status
+		if err = ra.SA.UpdateOrder(order, previous); err != nil {
+			return order, core.InternalServerError(err.Error())
+		}
+	}
+	if order.Status != core.StatusReady {
+		return order, core.UnauthorizedError(fmt.Sprintf("Order is %s, not ready to be finalized", order.Status))
+	}
+
+	if !csrMatchesOrder(req.CSR, order) {
+		return order, core.MalformedRequestError("CSR must request exactly the identifiers in the order")
+	}
+
+	// Issue against the order's own authorizations. If they don't cover the
+	// order, which the subscriber can't fix, the order is left as it is.
+	authzs := make([]core.Authorization, len(order.Authorizations))
+	for i, id := range order.Authorizations {
+		if authzs[i], err = ra.SA.GetAuthorization(id); err != nil {
+			return order, core.InternalServerError(err.Error())
+		}
+	}
+	now := time.Now()
+	for _, identifier := range order.Identifiers {
+		if _, err = authorizationFor(identifier, regID, authzs, now); err != nil {
+			return order, err
+		}
+	}
+
+	order.Status = core.StatusProcessing
+	if err = ra.SA.UpdateOrder(order, core.StatusReady); err != nil {
+		// Most likely another request is already finalizing the order
+		if current, getErr := ra.SA.GetOrder(order.ID); getErr == nil && current.Status != core.StatusReady {
+			return current, core.UnauthorizedError(fmt.Sprintf("Order is %s, not ready to be finalized", current.Status))
+		}
+		order.Status = core.StatusReady
+		return order, core.InternalServerError(err.Error())
+	}
+
+	cert, err := ra.issueCertificate(req, regID, authzs)
+	if err == nil {
+		var parsedCertificate *x509.Certificate
+		if parsedCertificate, err = x509.ParseCertificate(cert.DER); err != nil {
+			err = core.InternalServerError(err.Error())
+		} else {
+			order.Status = core.StatusValid
+			order.CertificateSerial = core.SerialToString(parsedCertificate.SerialNumber)
+		}
+	}
+	if err != nil {
+		if problem := orderProblem(err); problem != nil {
+			order.Status = core.StatusInvalid
+			order.Error = problem
+		} else {
+			order.Status = core.StatusReady
+		}
+	}
+
+	if updateErr := ra.SA.UpdateOrder(order, core.StatusProcessing); updateErr != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ra.log.Audit(fmt.Sprintf("Could not record outcome of order %s - status %s - %s", order.ID, order.Status, updateErr))
+		if err == nil {
+			err = core.InternalServerError(updateErr.Error())
+		}
+	}
+	return order, err
+}
+
+// orderStatus works out the status of a pending or ready order from its
+// authorizations: invalid if the order or any of them has expired, or any
+// of them has failed or been deactivated; ready if all of them are valid;
+// and pending otherwise. Orders in other states are left alone.
+func (ra *RegistrationAuthorityImpl) orderStatus(order core.Order) (core.AcmeStatus, error) {
+	if order.Status != core.StatusPending && order.Status != core.StatusReady {
+		return order.Status, nil
+	}
+	now := time.Now()
+	if order.Expires != nil && order.Expires.Before(now) {
+		return core.StatusInvalid, nil
+	}
+
+	status := core.StatusReady
+	for _, id := range order.Authorizations {
+		authz, err := ra.SA.GetAuthorization(id)
+		if err != nil {
+			return order.Status, err
+		}
+		switch authz.Status {
+		case core.StatusValid:
+			if authz.Expires != nil && authz.Expires.Before(now) {
+				return core.StatusInvalid, nil
+			}
+		case core.StatusPending, core.StatusProcessing, core.StatusUnknown:
+			status = core.StatusPending
+		default:
+			return core.StatusInvalid, nil
+		}
+	}
+	return status, nil
+}
+
+// updateOrders brings the status of a registration's unfinalized orders up
+// to date after one of its authorizations has changed.
+func (ra *RegistrationAuthorityImpl) updateOrders(authz core.Authorization) error {
+	orders, err := ra.SA.GetPendingOrders(authz.RegistrationID)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		uses := false
+		for _, id := range order.Authorizations {
+			if id == authz.ID {
+				uses = true
+				break
+			}
+		}
+		if !uses {
+			continue
+		}
+
+		status, err := ra.orderStatus(order)
+		if err != nil {
+			return err
+		}
+		if status != order.Status {
+			previous := order.Status
+			order.Status = status
+			if err = ra.SA.UpdateOrder(order, previous); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// csrMatchesOrder returns true if the CSR requests exactly the identifiers
+// in the order.
+func csrMatchesOrder(csr *x509.CertificateRequest, order core.Order) bool {
+	requested := make(map[core.AcmeIdentifier]bool)
+	dnsNames, ipAddresses := core.CSRNames(csr)
+	for _, name := range dnsNames {
+		requested[core.AcmeIdentifier{Type: core.IdentifierDNS, Value: strings.ToLower(name)}] = true
+	}
+	for _, ip := range ipAddresses {
+		requested[core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip.String()}] = true
+	}
+
+	if len(requested) != len(order.Identifiers) {
+		return false
+	}
+	for _, identifier := range order.Identifiers {
+		if !requested[identifier] {
+			return false
+		}
+	}
+	return true
+}
+
+// orderProblem describes an error caused by the subscriber's request, which
+// makes the order fail, to be kept with the order. It returns nil for other
+// errors, such as internal or RPC failures, which leave the order ready to be
+// finalized again.
+func orderProblem(err error) *core.ProblemDetails {
+	switch err.(type) {
+	case core.MalformedRequestError:
+		return &core.ProblemDetails{Type: core.MalformedProblem, Detail: err.Error()}
+	case core.UnauthorizedError:
+		return &core.ProblemDetails{Type: core.UnauthorizedProblem, Detail: err.Error()}
+	case core.RateLimitedError:
+		return &core.ProblemDetails{Type: core.RateLimitedProblem, Detail: err.Error()}
+	default:
+		return nil
+	}
+}
+
 // UpdateRegistration updates an existing Registration with new values.
 func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration, update core.Registration) (reg core.Registration, err error) {
 	base.MergeUpdate(update)
@@ -352,6 +980,65 @@ func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration,
 	return
 }
 
+// ChangeRegistrationKey replaces the account key of an existing Registration.
+// The caller is responsible for verifying that the request was signed by both
+// the current and the new key.
+func (ra *RegistrationAuthorityImpl) ChangeRegistrationKey(base core.Registration, newKey jose.JsonWebKey) (reg core.Registration, err error) {
+	if err = core.GoodKey(newKey.Key, ra.MaxKeySize); err != nil {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
+		return
+	}
+
+	if core.KeyDigestEquals(base.Key, newKey) {
+		err = core.MalformedRequestError("New key is the same as the current key")
+		return
+	}
+
+	if _, lookupErr := ra.SA.GetRegistrationByKey(newKey); lookupErr == nil {
+		err = core.MalformedRequestError("New key is already in use by a registration")
+		return
+	}
+
+	oldDigest, _ := core.KeyDigest(base.Key)
+	newDigest, _ := core.KeyDigest(newKey)
+
+	err = ra.SA.UpdateRegistrationKey(base.ID, newKey)
+	// AUDIT[ Key Changes ] 0ea0e5b9-4b07-4a7d-bb8f-6b7e2f1e6e31
+	if err != nil {
+		ra.log.Audit(fmt.Sprintf("Key change error - registration ID %d - %s -> %s - %s", base.ID, oldDigest, newDigest, err))
+		err = core.InternalServerError(fmt.Sprintf("Could not update registration key: %s", err))
+		return
+	}
+	ra.log.Audit(fmt.Sprintf("Key change - registration ID %d - %s -> %s", base.ID, oldDigest, newDigest))
+
+	reg = base
+	reg.Key = newKey
+	return
+}
+
+// DeactivateRegistration deactivates a Registration at its owner's request.
+// Its pending authorizations are invalidated, and its key stays reserved so
+// that it cannot be registered again.
+func (ra *RegistrationAuthorityImpl) DeactivateRegistration(base core.Registration) (reg core.Registration, err error) {
+	if base.Status == core.StatusDeactivated {
+		err = core.MalformedRequestError("Registration is already deactivated")
+		return
+	}
+
+	err = ra.SA.DeactivateRegistration(base.ID)
+	// AUDIT[ Registration Deactivations ] c3b9a8f4-5e2d-4d61-9f0a-7c1e84b2d9a6
+	if err != nil {
+		ra.log.Audit(fmt.Sprintf("Deactivation error - registration ID %d - %s", base.ID, err))
+		err = core.InternalServerError(fmt.Sprintf("Could not deactivate registration: %s", err))
+		return
+	}
+	ra.log.Audit(fmt.Sprintf("Deactivation - registration ID %d", base.ID))
+
+	reg = base
+	reg.Status = core.StatusDeactivated
+	return
+}
+
 // UpdateAuthorization updates an authorization with new values.
 func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
 	// Copy information over that the client is allowed to supply
@@ -360,15 +1047,38 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 		err = core.MalformedRequestError(fmt.Sprintf("Invalid challenge index: %d", challengeIndex))
 		return
 	}
-	authz.Challenges[challengeIndex] = authz.Challenges[challengeIndex].MergeResponse(response)
+	if authz.Expires != nil && authz.Expires.Before(time.Now()) {
+		err = core.MalformedRequestError("Authorization has expired")
+		return
+	}
+	if !ra.PA.ChallengeTypeEnabled(authz.Challenges[challengeIndex].Type) {
+		err = core.UnauthorizedError(fmt.Sprintf("Challenge type %s is disabled", authz.Challenges[challengeIndex].Type))
+		return
+	}
+	challenge := authz.Challenges[challengeIndex].MergeResponse(response)
+
+	if err = ra.checkInvalidAuthorizationLimit(authz.RegistrationID, authz.Identifier); err != nil {
+		return
+	}
 
-	// Store the updated version
-	if err = ra.SA.UpdatePendingAuthorization(authz); err != nil {
+	// Store the updated challenge alone, so that the results of other
+	// validations that finished since the client fetched the authorization
+	// are kept
+	stored, err := ra.SA.UpdatePendingChallenge(authz.ID, challengeIndex, challenge)
+	if err != nil {
 		// This can pretty much only happen when the client corrupts the Challenge
 		// data.
 		err = core.MalformedRequestError("Challenge data was corrupted")
 		return
 	}
+	authz = stored
+
+	// A challenge that has already been validated or has failed is not
+	// validated again
+	switch authz.Challenges[challengeIndex].Status {
+	case core.StatusValid, core.StatusInvalid:
+		return
+	}
 
 	// Look up the account key for this authorization
 	reg, err := ra.SA.GetRegistration(authz.RegistrationID)
@@ -383,10 +1093,44 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 	return
 }
 
-// RevokeCertificate terminates trust in the certificate provided.
-func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate) (err error) {
+// DeactivateAuthorization deactivates a pending or valid Authorization at the
+// request of its owner, so that it can no longer be used for issuance.
+func (ra *RegistrationAuthorityImpl) DeactivateAuthorization(base core.Authorization) (authz core.Authorization, err error) {
+	switch base.Status {
+	case core.StatusPending, core.StatusProcessing, core.StatusValid:
+	default:
+		err = core.MalformedRequestError(fmt.Sprintf("Cannot deactivate an authorization with status %s", base.Status))
+		return
+	}
+
+	err = ra.SA.DeactivateAuthorization(base.ID)
+	if err != nil {
+		ra.log.Audit(fmt.Sprintf("Authorization deactivation error - %s - %s", base.ID, err))
+		err = core.InternalServerError(fmt.Sprintf("Could not deactivate authorization: %s", err))
+		return
+	}
+	var regID int64 = base.RegistrationID
+	ra.log.Audit(fmt.Sprintf("Authorization deactivation - %s - registration ID %d - %s", base.ID, regID, auditName(base.Identifier.Value)))
+
+	authz = base
+	authz.Status = core.StatusDeactivated
+
+	// Orders that needed the authorization can no longer succeed
+	if orderErr := ra.updateOrders(authz); orderErr != nil {
+		ra.log.Warning(fmt.Sprintf("Could not update orders for deactivated authorization %s: %s", authz.ID, orderErr))
+	}
+	return
+}
+
+// RevokeCertificate terminates trust in the certificate provided, recording
+// the given RFC 5280 reason code.
+func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate, reasonCode int) (err error) {
 	serialString := core.SerialToString(cert.SerialNumber)
-	err = ra.CA.RevokeCertificate(serialString, 0)
+	if _, ok := core.RevocationReasons[reasonCode]; !ok {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid revocation reason code %d", reasonCode))
+		return err
+	}
+	err = ra.CA.RevokeCertificate(serialString, reasonCode)
 
 	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
 	if err != nil {
@@ -394,43 +1138,54 @@ func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate) (e
 		return err
 	}
 
-	ra.log.Audit(fmt.Sprintf("Revocation - %s", serialString))
+	ra.log.Audit(fmt.Sprintf("Revocation - %s - %s", serialString, core.RevocationReasons[reasonCode]))
 	return err
 }
 
 // OnValidationUpdate is called when a given Authorization is updated by the VA.
 func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization) error {
-	// Consider validation successful if any of the combinations
-	// specified in the authorization has been fulfilled
-	validated := map[int]bool{}
-	for i, ch := range authz.Challenges {
-		if ch.Status == core.StatusValid {
-			validated[i] = true
-		}
+	// Challenges may be validated one after another, so record each result
+	// in the stored authorization on its own rather than overwriting the
+	// results of validations that finished since the VA was handed its copy.
+	stored, err := ra.SA.GetAuthorization(authz.ID)
+	if err != nil {
+		return err
 	}
-	for _, combo := range authz.Combinations {
-		comboValid := true
-		for _, i := range combo {
-			if !validated[i] {
-				comboValid = false
-				break
-			}
+	switch stored.Status {
+	case core.StatusPending, core.StatusProcessing, core.StatusUnknown:
+	default:
+		ra.log.Warning(fmt.Sprintf("Ignoring validation of authorization %s with status %s", authz.ID, stored.Status))
+		return nil
+	}
+	for i, challenge := range authz.Challenges {
+		if challenge.Status != core.StatusValid && challenge.Status != core.StatusInvalid {
+			continue
 		}
-		if comboValid {
-			authz.Status = core.StatusValid
+		if stored, err = ra.SA.UpdatePendingChallenge(authz.ID, i, challenge); err != nil {
+			return err
 		}
 	}
+	authz = stored
 
-	// If no validation succeeded, then the authorization is invalid
-	// NOTE: This only works because we only ever do one validation
-	if authz.Status != core.StatusValid {
-		authz.Status = core.StatusInvalid
-	} else {
-		// TODO: Enable configuration of expiry time
-		exp := time.Now().Add(365 * 24 * time.Hour)
+	authz.Status = authorizationStatus(authz)
+	switch authz.Status {
+	case core.StatusPending:
+		// Some combination can still be satisfied
+		return nil
+	case core.StatusValid:
+		exp := time.Now().Add(ra.AuthorizationLifetime)
 		authz.Expires = &exp
 	}
 
-	// Finalize the authorization (error ignored)
-	return ra.SA.FinalizeAuthorization(authz)
+	// Finalize the authorization
+	if err = ra.SA.FinalizeAuthorization(authz); err != nil {
+		return err
+	}
+
+	// Orders are re-checked when they are finalized, so failing to update
+	// them here only delays their change of status.
+	if err = ra.updateOrders(authz); err != nil {
+		ra.log.Warning(fmt.Sprintf("Could not update orders for authorization %s: %s", authz.ID, err))
+	}
+	return nil
 }
@@ -200,6 +200,8 @@ func wrapError(err error) (rpcError RPCError) {
 			rpcError.Type = "SignatureValidationError"
 		case core.CertificateIssuanceError:
 			rpcError.Type = "CertificateIssuanceError"
+		case core.RateLimitedError:
+			rpcError.Type = "RateLimitedError"
 		}
 	}
 	return
@@ -225,6 +227,8 @@ func unwrapError(rpcError RPCError) (err error) {
 			err = core.SignatureValidationError(rpcError.Value)
 		case "CertificateIssuanceError":
 			err = core.CertificateIssuanceError(rpcError.Value)
+		case "RateLimitedError":
+			err = core.RateLimitedError(rpcError.Value)
 		default:
 			err = errors.New(rpcError.Value)
 		}
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"time"
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
@@ -34,31 +35,49 @@ import (
 
 // These strings are used by the RPC layer to identify function points.
 const (
-	MethodNewRegistration             = "NewRegistration"             // RA, SA
-	MethodNewAuthorization            = "NewAuthorization"            // RA
-	MethodNewCertificate              = "NewCertificate"              // RA
-	MethodUpdateRegistration          = "UpdateRegistration"          // RA, SA
-	MethodUpdateAuthorization         = "UpdateAuthorization"         // RA
-	MethodRevokeCertificate           = "RevokeCertificate"           // RA, CA
-	MethodOnValidationUpdate          = "OnValidationUpdate"          // RA
-	MethodUpdateValidations           = "UpdateValidations"           // VA
-	MethodCheckCAARecords             = "CheckCAARecords"             // VA
-	MethodIssueCertificate            = "IssueCertificate"            // CA
-	MethodGenerateOCSP                = "GenerateOCSP"                // CA
-	MethodGetRegistration             = "GetRegistration"             // SA
-	MethodGetRegistrationByKey        = "GetRegistrationByKey"        // RA, SA
-	MethodGetAuthorization            = "GetAuthorization"            // SA
-	MethodGetLatestValidAuthorization = "GetLatestValidAuthorization" // SA
-	MethodGetCertificate              = "GetCertificate"              // SA
-	MethodGetCertificateByShortSerial = "GetCertificateByShortSerial" // SA
-	MethodGetCertificateStatus        = "GetCertificateStatus"        // SA
-	MethodMarkCertificateRevoked      = "MarkCertificateRevoked"      // SA
-	MethodUpdateOCSP                  = "UpdateOCSP"                  // SA
-	MethodNewPendingAuthorization     = "NewPendingAuthorization"     // SA
-	MethodUpdatePendingAuthorization  = "UpdatePendingAuthorization"  // SA
-	MethodFinalizeAuthorization       = "FinalizeAuthorization"       // SA
-	MethodAddCertificate              = "AddCertificate"              // SA
-	MethodAlreadyDeniedCSR            = "AlreadyDeniedCSR"            // SA
+	MethodNewRegistration             = "NewRegistration"                 // RA, SA
+	MethodNewAuthorization            = "NewAuthorization"                // RA
+	MethodNewCertificate              = "NewCertificate"                  // RA
+	MethodUpdateRegistration          = "UpdateRegistration"              // RA, SA
+	MethodChangeRegistrationKey       = "ChangeRegistrationKey"           // RA
+	MethodUpdateRegistrationKey       = "UpdateRegistrationKey"           // SA
+	MethodDeactivateRegistration      = "DeactivateRegistration"          // RA, SA
+	MethodUpdateAuthorization         = "UpdateAuthorization"             // RA
+	MethodDeactivateAuthorization     = "DeactivateAuthorization"         // RA, SA
+	MethodRevokeCertificate           = "RevokeCertificate"               // RA, CA
+	MethodOnValidationUpdate          = "OnValidationUpdate"              // RA
+	MethodUpdateValidations           = "UpdateValidations"               // VA
+	MethodCheckCAARecords             = "CheckCAARecords"                 // VA
+	MethodIssueCertificate            = "IssueCertificate"                // CA
+	MethodGenerateOCSP                = "GenerateOCSP"                    // CA
+	MethodGetRegistration             = "GetRegistration"                 // SA
+	MethodGetRegistrationByKey        = "GetRegistrationByKey"            // RA, SA
+	MethodGetAuthorization            = "GetAuthorization"                // SA
+	MethodGetLatestValidAuthorization = "GetLatestValidAuthorization"     // SA
+	MethodGetAuthorizationsByReg      = "GetAuthorizationsByRegistration" // SA
+	MethodGetAuthorizationsByIdent    = "GetAuthorizationsByIdentifier"   // SA
+	MethodGetCertificate              = "GetCertificate"                  // SA
+	MethodGetCertificateByShortSerial = "GetCertificateByShortSerial"     // SA
+	MethodGetCertificateStatus        = "GetCertificateStatus"            // SA
+	MethodGetCertificatesByReg        = "GetCertificatesByRegistration"   // SA
+	MethodMarkCertificateRevoked      = "MarkCertificateRevoked"          // SA
+	MethodUpdateOCSP                  = "UpdateOCSP"                      // SA
+	MethodNewPendingAuthorization     = "NewPendingAuthorization"         // SA
+	MethodUpdatePendingAuthorization  = "UpdatePendingAuthorization"      // SA
+	MethodUpdatePendingChallenge      = "UpdatePendingChallenge"          // SA
+	MethodFinalizeAuthorization       = "FinalizeAuthorization"           // SA
+	MethodAddCertificate              = "AddCertificate"                  // SA
+	MethodNewOrder                    = "NewOrder"                        // RA, SA
+	MethodFinalizeOrder               = "FinalizeOrder"                   // RA
+	MethodGetOrder                    = "GetOrder"                        // SA
+	MethodGetPendingOrders            = "GetPendingOrders"                // SA
+	MethodUpdateOrder                 = "UpdateOrder"                     // SA
+	MethodCountCertificatesByNames    = "CountCertificatesByNames"        // SA
+	MethodCountFQDNSets               = "CountFQDNSets"                   // SA
+	MethodCountRegistrationsByIP      = "CountRegistrationsByIP"          // SA
+	MethodCountPendingAuthorizations  = "CountPendingAuthorizations"      // SA
+	MethodCountInvalidAuthorizations  = "CountInvalidAuthorizations"      // SA
+	MethodAlreadyDeniedCSR            = "AlreadyDeniedCSR"                // SA
 )
 
 // Request structs
@@ -74,6 +93,16 @@ type updateRegistrationRequest struct {
 	Base, Update core.Registration
 }
 
+type changeRegistrationKeyRequest struct {
+	Base   core.Registration
+	NewKey jose.JsonWebKey
+}
+
+type updateRegistrationKeyRequest struct {
+	ID  int64
+	Key jose.JsonWebKey
+}
+
 type authorizationRequest struct {
 	Authz core.Authorization
 	RegID int64
@@ -85,11 +114,69 @@ type updateAuthorizationRequest struct {
 	Response core.Challenge
 }
 
+type updateChallengeRequest struct {
+	ID        string
+	Index     int
+	Challenge core.Challenge
+}
+
 type latestValidAuthorizationRequest struct {
 	RegID      int64
 	Identifier core.AcmeIdentifier
 }
 
+type byIdentifierRequest struct {
+	RegID      int64
+	Identifier core.AcmeIdentifier
+	ValidUntil time.Time
+}
+
+type byRegistrationRequest struct {
+	RegID  int64
+	Offset int
+	Limit  int
+}
+
+type orderRequest struct {
+	Order core.Order
+	RegID int64
+}
+
+type updateOrderRequest struct {
+	Order  core.Order
+	Status core.AcmeStatus
+}
+
+type finalizeOrderRequest struct {
+	Order core.Order
+	Req   core.CertificateRequest
+	RegID int64
+}
+
+type countCertificatesByNamesRequest struct {
+	Domains  []string
+	Earliest time.Time
+	Latest   time.Time
+}
+
+type countFQDNSetsRequest struct {
+	Window time.Duration
+	Names  []string
+}
+
+type countRegistrationsByIPRequest struct {
+	IP       net.IP
+	Earliest time.Time
+	Latest   time.Time
+}
+
+type countInvalidAuthorizationsRequest struct {
+	RegID      int64
+	Identifier core.AcmeIdentifier
+	Earliest   time.Time
+	Latest     time.Time
+}
+
 type certificateRequest struct {
 	Req   core.CertificateRequest
 	RegID int64
@@ -106,6 +193,11 @@ type addCertificateRequest struct {
 	RegID int64
 }
 
+type raRevokeCertificateRequest struct {
+	Cert       []byte
+	ReasonCode int
+}
+
 type revokeCertificateRequest struct {
 	Serial     string
 	ReasonCode int
@@ -248,6 +340,51 @@ func NewRegistrationAuthorityServer(rpc RPCServer, impl core.RegistrationAuthori
 		return
 	})
 
+	rpc.Handle(MethodChangeRegistrationKey, func(req []byte) (response []byte, err error) {
+		var crkReq changeRegistrationKeyRequest
+		err = json.Unmarshal(req, &crkReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodChangeRegistrationKey, err, req)
+			return
+		}
+
+		reg, err := impl.ChangeRegistrationKey(crkReq.Base, crkReq.NewKey)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodChangeRegistrationKey, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodDeactivateRegistration, func(req []byte) (response []byte, err error) {
+		var rr registrationRequest
+		if err = json.Unmarshal(req, &rr); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateRegistration, err, req)
+			return
+		}
+
+		reg, err := impl.DeactivateRegistration(rr.Reg)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateRegistration, err, req)
+			return
+		}
+		return
+	})
+
 	rpc.Handle(MethodUpdateAuthorization, func(req []byte) (response []byte, err error) {
 		var uaReq updateAuthorizationRequest
 		err = json.Unmarshal(req, &uaReq)
@@ -271,15 +408,88 @@ func NewRegistrationAuthorityServer(rpc RPCServer, impl core.RegistrationAuthori
 		return
 	})
 
+	rpc.Handle(MethodDeactivateAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateAuthorization, err, req)
+			return
+		}
+
+		newAuthz, err := impl.DeactivateAuthorization(authz)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(newAuthz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateAuthorization, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewOrder, func(req []byte) (response []byte, err error) {
+		var oReq orderRequest
+		if err = json.Unmarshal(req, &oReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewOrder, err, req)
+			return
+		}
+
+		order, err := impl.NewOrder(oReq.Order, oReq.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewOrder, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodFinalizeOrder, func(req []byte) (response []byte, err error) {
+		var foReq finalizeOrderRequest
+		if err = json.Unmarshal(req, &foReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodFinalizeOrder, err, req)
+			return
+		}
+
+		order, err := impl.FinalizeOrder(foReq.Order, foReq.Req, foReq.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodFinalizeOrder, err, req)
+			return
+		}
+		return
+	})
+
 	rpc.Handle(MethodRevokeCertificate, func(req []byte) (response []byte, err error) {
-		certs, err := x509.ParseCertificates(req)
+		var revokeReq raRevokeCertificateRequest
+		if err = json.Unmarshal(req, &revokeReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodRevokeCertificate, err, req)
+			return
+		}
+
+		certs, err := x509.ParseCertificates(revokeReq.Cert)
 		if err != nil || len(certs) == 0 {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodRevokeCertificate, err, req)
 			return
 		}
 
-		err = impl.RevokeCertificate(*certs[0])
+		err = impl.RevokeCertificate(*certs[0], revokeReq.ReasonCode)
 		return
 	})
 
@@ -341,6 +551,38 @@ func (rac RegistrationAuthorityClient) NewAuthorization(authz core.Authorization
 	return
 }
 
+// NewOrder sends a New Order request
+func (rac RegistrationAuthorityClient) NewOrder(order core.Order, regID int64) (newOrder core.Order, err error) {
+	data, err := json.Marshal(orderRequest{order, regID})
+	if err != nil {
+		return
+	}
+
+	newOrderData, err := rac.rpc.DispatchSync(MethodNewOrder, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newOrderData, &newOrder)
+	return
+}
+
+// FinalizeOrder sends a Finalize Order request
+func (rac RegistrationAuthorityClient) FinalizeOrder(order core.Order, cr core.CertificateRequest, regID int64) (newOrder core.Order, err error) {
+	data, err := json.Marshal(finalizeOrderRequest{order, cr, regID})
+	if err != nil {
+		return
+	}
+
+	newOrderData, err := rac.rpc.DispatchSync(MethodFinalizeOrder, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newOrderData, &newOrder)
+	return
+}
+
 // NewCertificate sends a New Certificate request
 func (rac RegistrationAuthorityClient) NewCertificate(cr core.CertificateRequest, regID int64) (cert core.Certificate, err error) {
 	data, err := json.Marshal(certificateRequest{cr, regID})
@@ -377,6 +619,42 @@ func (rac RegistrationAuthorityClient) UpdateRegistration(base core.Registration
 	return
 }
 
+// ChangeRegistrationKey sends a Change Registration Key request
+func (rac RegistrationAuthorityClient) ChangeRegistrationKey(base core.Registration, newKey jose.JsonWebKey) (newReg core.Registration, err error) {
+	var crkReq changeRegistrationKeyRequest
+	crkReq.Base = base
+	crkReq.NewKey = newKey
+
+	data, err := json.Marshal(crkReq)
+	if err != nil {
+		return
+	}
+
+	newRegData, err := rac.rpc.DispatchSync(MethodChangeRegistrationKey, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newRegData, &newReg)
+	return
+}
+
+// DeactivateRegistration sends a Deactivate Registration request
+func (rac RegistrationAuthorityClient) DeactivateRegistration(reg core.Registration) (newReg core.Registration, err error) {
+	data, err := json.Marshal(registrationRequest{reg})
+	if err != nil {
+		return
+	}
+
+	newRegData, err := rac.rpc.DispatchSync(MethodDeactivateRegistration, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newRegData, &newReg)
+	return
+}
+
 // UpdateAuthorization sends an Update Authorization request
 func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorization, index int, response core.Challenge) (newAuthz core.Authorization, err error) {
 	var uaReq updateAuthorizationRequest
@@ -398,9 +676,36 @@ func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorizat
 	return
 }
 
+// DeactivateAuthorization sends a Deactivate Authorization request
+func (rac RegistrationAuthorityClient) DeactivateAuthorization(authz core.Authorization) (newAuthz core.Authorization, err error) {
+	data, err := json.Marshal(authz)
+	if err != nil {
+		return
+	}
+
+	newAuthzData, err := rac.rpc.DispatchSync(MethodDeactivateAuthorization, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newAuthzData, &newAuthz)
+	return
+}
+
 // RevokeCertificate sends a Revoke Certificate request
-func (rac RegistrationAuthorityClient) RevokeCertificate(cert x509.Certificate) (err error) {
-	_, err = rac.rpc.DispatchSync(MethodRevokeCertificate, cert.Raw)
+func (rac RegistrationAuthorityClient) RevokeCertificate(cert x509.Certificate, reasonCode int) (err error) {
+	var revokeReq raRevokeCertificateRequest
+	revokeReq.Cert = cert.Raw
+	revokeReq.ReasonCode = reasonCode
+
+	data, err := json.Marshal(revokeReq)
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		errorCondition(MethodRevokeCertificate, err, revokeReq)
+		return
+	}
+
+	_, err = rac.rpc.DispatchSync(MethodRevokeCertificate, data)
 	return
 }
 
@@ -663,6 +968,30 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
+	rpc.Handle(MethodUpdateRegistrationKey, func(req []byte) (response []byte, err error) {
+		var urkReq updateRegistrationKeyRequest
+		if err = json.Unmarshal(req, &urkReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateRegistrationKey, err, req)
+			return
+		}
+
+		err = impl.UpdateRegistrationKey(urkReq.ID, urkReq.Key)
+		return
+	})
+
+	rpc.Handle(MethodDeactivateRegistration, func(req []byte) (response []byte, err error) {
+		var grReq getRegistrationRequest
+		if err = json.Unmarshal(req, &grReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateRegistration, err, req)
+			return
+		}
+
+		err = impl.DeactivateRegistration(grReq.ID)
+		return
+	})
+
 	rpc.Handle(MethodGetRegistration, func(req []byte) (response []byte, err error) {
 		var grReq getRegistrationRequest
 		err = json.Unmarshal(req, &grReq)
@@ -745,93 +1074,345 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
-	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
-		var acReq addCertificateRequest
-		err = json.Unmarshal(req, &acReq)
-		if err != nil {
+	rpc.Handle(MethodGetAuthorizationsByIdent, func(req []byte) (response []byte, err error) {
+		var biReq byIdentifierRequest
+		if err = json.Unmarshal(req, &biReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAddCertificate, err, req)
+			improperMessage(MethodGetAuthorizationsByIdent, err, req)
 			return
 		}
 
-		id, err := impl.AddCertificate(acReq.Bytes, acReq.RegID)
+		authzs, err := impl.GetAuthorizationsByIdentifier(biReq.RegID, biReq.Identifier, biReq.ValidUntil)
 		if err != nil {
 			return
 		}
-		response = []byte(id)
+
+		response, err = json.Marshal(authzs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetAuthorizationsByIdent, err, req)
+			return
+		}
 		return
 	})
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
-		var registration core.Registration
-		err = json.Unmarshal(req, &registration)
-		if err != nil {
+	rpc.Handle(MethodGetAuthorizationsByReg, func(req []byte) (response []byte, err error) {
+		var brReq byRegistrationRequest
+		if err = json.Unmarshal(req, &brReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewRegistration, err, req)
+			improperMessage(MethodGetAuthorizationsByReg, err, req)
 			return
 		}
 
-		output, err := impl.NewRegistration(registration)
+		authzs, err := impl.GetAuthorizationsByRegistration(brReq.RegID, brReq.Offset, brReq.Limit)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(output)
+		response, err = json.Marshal(authzs)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, req)
+			errorCondition(MethodGetAuthorizationsByReg, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodCountCertificatesByNames, func(req []byte) (response []byte, err error) {
+		var ccReq countCertificatesByNamesRequest
+		if err = json.Unmarshal(req, &ccReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewPendingAuthorization, err, req)
+			improperMessage(MethodCountCertificatesByNames, err, req)
 			return
 		}
 
-		output, err := impl.NewPendingAuthorization(authz)
+		counts, err := impl.CountCertificatesByNames(ccReq.Domains, ccReq.Earliest, ccReq.Latest)
 		if err != nil {
 			return
 		}
 
-		response, err = json.Marshal(output)
+		response, err = json.Marshal(counts)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewPendingAuthorization, err, req)
+			errorCondition(MethodCountCertificatesByNames, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodCountFQDNSets, func(req []byte) (response []byte, err error) {
+		var cfReq countFQDNSetsRequest
+		if err = json.Unmarshal(req, &cfReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdatePendingAuthorization, err, req)
+			improperMessage(MethodCountFQDNSets, err, req)
 			return
 		}
 
-		err = impl.UpdatePendingAuthorization(authz)
+		count, err := impl.CountFQDNSets(cfReq.Window, cfReq.Names)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountFQDNSets, err, req)
+			return
+		}
 		return
 	})
 
-	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
-		var authz core.Authorization
-		if err = json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodCountRegistrationsByIP, func(req []byte) (response []byte, err error) {
+		var crReq countRegistrationsByIPRequest
+		if err = json.Unmarshal(req, &crReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodFinalizeAuthorization, err, req)
+			improperMessage(MethodCountRegistrationsByIP, err, req)
 			return
 		}
 
-		err = impl.FinalizeAuthorization(authz)
-		return
-	})
-
-	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte, err error) {
+		count, err := impl.CountRegistrationsByIP(crReq.IP, crReq.Earliest, crReq.Latest)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountRegistrationsByIP, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodCountPendingAuthorizations, func(req []byte) (response []byte, err error) {
+		var cpReq getRegistrationRequest
+		if err = json.Unmarshal(req, &cpReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountPendingAuthorizations, err, req)
+			return
+		}
+
+		count, err := impl.CountPendingAuthorizations(cpReq.ID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountPendingAuthorizations, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodCountInvalidAuthorizations, func(req []byte) (response []byte, err error) {
+		var ciReq countInvalidAuthorizationsRequest
+		if err = json.Unmarshal(req, &ciReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountInvalidAuthorizations, err, req)
+			return
+		}
+
+		count, err := impl.CountInvalidAuthorizations(ciReq.RegID, ciReq.Identifier, ciReq.Earliest, ciReq.Latest)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountInvalidAuthorizations, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetOrder, func(req []byte) (response []byte, err error) {
+		order, err := impl.GetOrder(string(req))
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetOrder, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetPendingOrders, func(req []byte) (response []byte, err error) {
+		var gpoReq getRegistrationRequest
+		if err = json.Unmarshal(req, &gpoReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetPendingOrders, err, req)
+			return
+		}
+
+		orders, err := impl.GetPendingOrders(gpoReq.ID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(orders)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetPendingOrders, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewOrder, func(req []byte) (response []byte, err error) {
+		var order core.Order
+		if err = json.Unmarshal(req, &order); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewOrder, err, req)
+			return
+		}
+
+		output, err := impl.NewOrder(order)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewOrder, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodUpdateOrder, func(req []byte) (response []byte, err error) {
+		var uoReq updateOrderRequest
+		if err = json.Unmarshal(req, &uoReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateOrder, err, req)
+			return
+		}
+
+		err = impl.UpdateOrder(uoReq.Order, uoReq.Status)
+		return
+	})
+
+	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
+		var acReq addCertificateRequest
+		err = json.Unmarshal(req, &acReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddCertificate, err, req)
+			return
+		}
+
+		id, err := impl.AddCertificate(acReq.Bytes, acReq.RegID)
+		if err != nil {
+			return
+		}
+		response = []byte(id)
+		return
+	})
+
+	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
+		var registration core.Registration
+		err = json.Unmarshal(req, &registration)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewRegistration, err, req)
+			return
+		}
+
+		output, err := impl.NewRegistration(registration)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewRegistration, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewPendingAuthorization, err, req)
+			return
+		}
+
+		output, err := impl.NewPendingAuthorization(authz)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewPendingAuthorization, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdatePendingAuthorization, err, req)
+			return
+		}
+
+		err = impl.UpdatePendingAuthorization(authz)
+		return
+	})
+
+	rpc.Handle(MethodUpdatePendingChallenge, func(req []byte) (response []byte, err error) {
+		var ucReq updateChallengeRequest
+		if err = json.Unmarshal(req, &ucReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdatePendingChallenge, err, req)
+			return
+		}
+
+		authz, err := impl.UpdatePendingChallenge(ucReq.ID, ucReq.Index, ucReq.Challenge)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdatePendingChallenge, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodFinalizeAuthorization, err, req)
+			return
+		}
+
+		err = impl.FinalizeAuthorization(authz)
+		return
+	})
+
+	rpc.Handle(MethodDeactivateAuthorization, func(req []byte) (response []byte, err error) {
+		err = impl.DeactivateAuthorization(string(req))
+		return
+	})
+
+	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte, err error) {
 		cert, err := impl.GetCertificate(string(req))
 		if err != nil {
 			return
@@ -878,6 +1459,28 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		return
 	})
 
+	rpc.Handle(MethodGetCertificatesByReg, func(req []byte) (response []byte, err error) {
+		var brReq byRegistrationRequest
+		if err = json.Unmarshal(req, &brReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetCertificatesByReg, err, req)
+			return
+		}
+
+		certs, err := impl.GetCertificatesByRegistration(brReq.RegID, brReq.Offset, brReq.Limit)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(certs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetCertificatesByReg, err, req)
+			return
+		}
+		return
+	})
+
 	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte, err error) {
 		var mcrReq markCertificateRevokedRequest
 
@@ -1008,6 +1611,40 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationId int
 	return
 }
 
+// GetAuthorizationsByIdentifier sends a request to get the valid and pending
+// Authorizations a registration holds for an identifier
+func (cac StorageAuthorityClient) GetAuthorizationsByIdentifier(regID int64, identifier core.AcmeIdentifier, validUntil time.Time) (authzs []core.Authorization, err error) {
+	data, err := json.Marshal(byIdentifierRequest{regID, identifier, validUntil})
+	if err != nil {
+		return
+	}
+
+	jsonAuthzs, err := cac.rpc.DispatchSync(MethodGetAuthorizationsByIdent, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthzs, &authzs)
+	return
+}
+
+// GetAuthorizationsByRegistration sends a request to get a page of the
+// Authorizations belonging to a registration
+func (cac StorageAuthorityClient) GetAuthorizationsByRegistration(regID int64, offset, limit int) (authzs []core.Authorization, err error) {
+	data, err := json.Marshal(byRegistrationRequest{regID, offset, limit})
+	if err != nil {
+		return
+	}
+
+	jsonAuthzs, err := cac.rpc.DispatchSync(MethodGetAuthorizationsByReg, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthzs, &authzs)
+	return
+}
+
 // GetCertificate sends a request to get a Certificate by ID
 func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certificate, err error) {
 	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificate, []byte(id))
@@ -1043,6 +1680,23 @@ func (cac StorageAuthorityClient) GetCertificateStatus(id string) (status core.C
 	return
 }
 
+// GetCertificatesByRegistration sends a request to get a page of the
+// certificates issued to a registration
+func (cac StorageAuthorityClient) GetCertificatesByRegistration(regID int64, offset, limit int) (certs []core.Certificate, err error) {
+	data, err := json.Marshal(byRegistrationRequest{regID, offset, limit})
+	if err != nil {
+		return
+	}
+
+	jsonCerts, err := cac.rpc.DispatchSync(MethodGetCertificatesByReg, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCerts, &certs)
+	return
+}
+
 // MarkCertificateRevoked sends a request to mark a certificate as revoked
 func (cac StorageAuthorityClient) MarkCertificateRevoked(serial string, ocspResponse []byte, reasonCode int) (err error) {
 	var mcrReq markCertificateRevokedRequest
@@ -1087,6 +1741,32 @@ func (cac StorageAuthorityClient) UpdateRegistration(reg core.Registration) (err
 	return
 }
 
+// UpdateRegistrationKey sends a request to replace the key of a registration
+func (cac StorageAuthorityClient) UpdateRegistrationKey(id int64, key jose.JsonWebKey) (err error) {
+	var urkReq updateRegistrationKeyRequest
+	urkReq.ID = id
+	urkReq.Key = key
+
+	data, err := json.Marshal(urkReq)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodUpdateRegistrationKey, data)
+	return
+}
+
+// DeactivateRegistration sends a request to deactivate a registration
+func (cac StorageAuthorityClient) DeactivateRegistration(id int64) (err error) {
+	data, err := json.Marshal(getRegistrationRequest{id})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodDeactivateRegistration, data)
+	return
+}
+
 // NewRegistration sends a request to store a new registration
 func (cac StorageAuthorityClient) NewRegistration(reg core.Registration) (output core.Registration, err error) {
 	jsonReg, err := json.Marshal(reg)
@@ -1136,6 +1816,28 @@ func (cac StorageAuthorityClient) UpdatePendingAuthorization(authz core.Authoriz
 	return
 }
 
+// UpdatePendingChallenge sends a request to record a change to one challenge
+// of a pending authorization
+func (cac StorageAuthorityClient) UpdatePendingChallenge(id string, index int, challenge core.Challenge) (authz core.Authorization, err error) {
+	ucReq := updateChallengeRequest{
+		ID:        id,
+		Index:     index,
+		Challenge: challenge,
+	}
+	data, err := json.Marshal(ucReq)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodUpdatePendingChallenge, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &authz)
+	return
+}
+
 // FinalizeAuthorization sends a request to finalize an authorization (convert
 // from pending)
 func (cac StorageAuthorityClient) FinalizeAuthorization(authz core.Authorization) (err error) {
@@ -1148,6 +1850,158 @@ func (cac StorageAuthorityClient) FinalizeAuthorization(authz core.Authorization
 	return
 }
 
+// DeactivateAuthorization sends a request to deactivate a pending or valid
+// authorization
+func (cac StorageAuthorityClient) DeactivateAuthorization(id string) (err error) {
+	_, err = cac.rpc.DispatchSync(MethodDeactivateAuthorization, []byte(id))
+	return
+}
+
+// CountCertificatesByNames sends a request to count the certificates issued
+// for each of a set of domains and their subdomains
+func (cac StorageAuthorityClient) CountCertificatesByNames(domains []string, earliest, latest time.Time) (counts map[string]int, err error) {
+	data, err := json.Marshal(countCertificatesByNamesRequest{domains, earliest, latest})
+	if err != nil {
+		return
+	}
+
+	jsonCounts, err := cac.rpc.DispatchSync(MethodCountCertificatesByNames, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCounts, &counts)
+	return
+}
+
+// CountFQDNSets sends a request to count the certificates issued recently for
+// exactly a set of names
+func (cac StorageAuthorityClient) CountFQDNSets(window time.Duration, names []string) (count int64, err error) {
+	data, err := json.Marshal(countFQDNSetsRequest{window, names})
+	if err != nil {
+		return
+	}
+
+	jsonCount, err := cac.rpc.DispatchSync(MethodCountFQDNSets, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCount, &count)
+	return
+}
+
+// CountRegistrationsByIP sends a request to count the registrations created
+// from an IP address
+func (cac StorageAuthorityClient) CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (count int, err error) {
+	data, err := json.Marshal(countRegistrationsByIPRequest{ip, earliest, latest})
+	if err != nil {
+		return
+	}
+
+	jsonCount, err := cac.rpc.DispatchSync(MethodCountRegistrationsByIP, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCount, &count)
+	return
+}
+
+// CountPendingAuthorizations sends a request to count the pending
+// authorizations belonging to a registration
+func (cac StorageAuthorityClient) CountPendingAuthorizations(regID int64) (count int, err error) {
+	data, err := json.Marshal(getRegistrationRequest{regID})
+	if err != nil {
+		return
+	}
+
+	jsonCount, err := cac.rpc.DispatchSync(MethodCountPendingAuthorizations, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCount, &count)
+	return
+}
+
+// CountInvalidAuthorizations sends a request to count the recently failed
+// authorizations for an identifier belonging to a registration
+func (cac StorageAuthorityClient) CountInvalidAuthorizations(regID int64, identifier core.AcmeIdentifier, earliest, latest time.Time) (count int, err error) {
+	data, err := json.Marshal(countInvalidAuthorizationsRequest{regID, identifier, earliest, latest})
+	if err != nil {
+		return
+	}
+
+	jsonCount, err := cac.rpc.DispatchSync(MethodCountInvalidAuthorizations, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonCount, &count)
+	return
+}
+
+// GetOrder sends a request to get an Order by ID
+func (cac StorageAuthorityClient) GetOrder(id string) (order core.Order, err error) {
+	jsonOrder, err := cac.rpc.DispatchSync(MethodGetOrder, []byte(id))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonOrder, &order)
+	return
+}
+
+// GetPendingOrders sends a request to get the orders of a registration that
+// have not been finalized
+func (cac StorageAuthorityClient) GetPendingOrders(regID int64) (orders []core.Order, err error) {
+	data, err := json.Marshal(getRegistrationRequest{regID})
+	if err != nil {
+		return
+	}
+
+	jsonOrders, err := cac.rpc.DispatchSync(MethodGetPendingOrders, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonOrders, &orders)
+	return
+}
+
+// NewOrder sends a request to store a new order
+func (cac StorageAuthorityClient) NewOrder(order core.Order) (output core.Order, err error) {
+	jsonOrder, err := json.Marshal(order)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodNewOrder, jsonOrder)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &output)
+	return
+}
+
+// UpdateOrder sends a request to update an order that still has the given
+// status
+func (cac StorageAuthorityClient) UpdateOrder(order core.Order, status core.AcmeStatus) (err error) {
+	uoReq := updateOrderRequest{
+		Order:  order,
+		Status: status,
+	}
+	data, err := json.Marshal(uoReq)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodUpdateOrder, data)
+	return
+}
+
 // AddCertificate sends a request to record the issuance of a certificate
 func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id string, err error) {
 	var acReq addCertificateRequest
@@ -115,4 +115,11 @@ func initTables(dbMap *gorp.DbMap) {
 	dbMap.AddTableWithName(core.OCSPResponse{}, "ocspResponses").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.DeniedCSR{}, "deniedCSRs").SetKeys(true, "ID")
+
+	dbMap.AddTableWithName(issuedNameModel{}, "issuedNames").SetKeys(true, "ID")
+	dbMap.AddTableWithName(fqdnSetModel{}, "fqdnSets").SetKeys(true, "ID")
+
+	orderTable := dbMap.AddTableWithName(core.Order{}, "orders").SetKeys(false, "ID")
+	orderTable.ColMap("Identifiers").SetMaxSize(1536)
+	orderTable.ColMap("Authorizations").SetMaxSize(1536)
 }
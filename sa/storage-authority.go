@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 	"time"
@@ -35,6 +36,10 @@ func digest256(data []byte) []byte {
 	return d.Sum(nil)
 }
 
+// maxChallengeUpdateAttempts bounds how many times UpdatePendingChallenge
+// retries an update that raced with another.
+const maxChallengeUpdateAttempts = 3
+
 // Utility models
 type pendingauthzModel struct {
 	core.Authorization
@@ -46,6 +51,52 @@ type authzModel struct {
 	core.Authorization
 
 	Sequence int64 `db:"sequence"`
+
+	// When the authorization became invalid, which is what the limit on
+	// failed validations counts
+	Failed *time.Time `db:"failed"`
+}
+
+// issuedNameModel indexes the names in issued certificates, reversed so
+// that certificates for all the subdomains of a domain can be found by
+// prefix, for rate limiting.
+type issuedNameModel struct {
+	ID           int64     `db:"id"`
+	ReversedName string    `db:"reversedName"`
+	Serial       string    `db:"serial"`
+	Issued       time.Time `db:"issued"`
+}
+
+// fqdnSetModel records the exact set of names each certificate was issued
+// for, so that duplicate certificates can be rate limited.
+type fqdnSetModel struct {
+	ID      int64     `db:"id"`
+	SetHash []byte    `db:"setHash"`
+	Serial  string    `db:"serial"`
+	Issued  time.Time `db:"issued"`
+	Expires time.Time `db:"expires"`
+}
+
+// reverseName reverses the labels of a domain name, e.g. "com.example.www"
+// for "www.example.com".
+func reverseName(domain string) string {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// hashNames returns a digest of a set of names, independent of their order,
+// case and repetition.
+func hashNames(names []string) []byte {
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(name)
+	}
+	lowered = core.UniqueNames(lowered)
+	sort.Strings(lowered)
+	return digest256([]byte(strings.Join(lowered, ",")))
 }
 
 // NewSQLStorageAuthority provides persistence using a SQL backend for Boulder.
@@ -94,6 +145,12 @@ func existingFinal(tx *gorp.Transaction, id string) bool {
 	return count > 0
 }
 
+func existingOrder(tx *gorp.Transaction, id string) bool {
+	var count int64
+	_ = tx.SelectOne(&count, "SELECT count(*) FROM orders WHERE id = :id", map[string]interface{}{"id": id})
+	return count > 0
+}
+
 func existingRegistration(tx *gorp.Transaction, id int64) bool {
 	var count int64
 	_ = tx.SelectOne(&count, "SELECT count(*) FROM registrations WHERE id = :id", map[string]interface{}{"id": id})
@@ -180,6 +237,52 @@ func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationId int64
 	return
 }
 
+// GetAuthorizationsByIdentifier returns the valid and pending authorizations
+// a registration holds for an identifier that remain usable until at least
+// validUntil. Valid authorizations come first, latest expiring first.
+func (ssa *SQLStorageAuthority) GetAuthorizationsByIdentifier(regID int64, identifier core.AcmeIdentifier, validUntil time.Time) (authzs []core.Authorization, err error) {
+	ident, err := json.Marshal(identifier)
+	if err != nil {
+		return
+	}
+	params := map[string]interface{}{
+		"identifier": string(ident),
+		"regID":      regID,
+		"validUntil": validUntil,
+	}
+
+	_, err = ssa.dbMap.Select(&authzs, "SELECT id, identifier, registrationID, status, expires, challenges, combinations "+
+		"FROM authz "+
+		"WHERE identifier = :identifier AND registrationID = :regID AND status = 'valid' AND expires > :validUntil "+
+		"ORDER BY expires DESC",
+		params)
+	if err != nil {
+		return
+	}
+
+	var pending []core.Authorization
+	_, err = ssa.dbMap.Select(&pending, "SELECT id, identifier, registrationID, status, expires, challenges, combinations "+
+		"FROM pending_authz "+
+		"WHERE identifier = :identifier AND registrationID = :regID AND (expires IS NULL OR expires > :validUntil) "+
+		"ORDER BY expires DESC",
+		params)
+	authzs = append(authzs, pending...)
+	return
+}
+
+// GetAuthorizationsByRegistration returns a page of the pending and final
+// authorizations belonging to a registration, ordered by ID.
+func (ssa *SQLStorageAuthority) GetAuthorizationsByRegistration(regID int64, offset, limit int) (authzs []core.Authorization, err error) {
+	_, err = ssa.dbMap.Select(&authzs, "SELECT id, identifier, registrationID, status, expires, challenges, combinations "+
+		"FROM pending_authz WHERE registrationID = :regID "+
+		"UNION ALL "+
+		"SELECT id, identifier, registrationID, status, expires, challenges, combinations "+
+		"FROM authz WHERE registrationID = :regID "+
+		"ORDER BY id LIMIT :limit OFFSET :offset",
+		map[string]interface{}{"regID": regID, "limit": limit, "offset": offset})
+	return
+}
+
 // GetCertificateByShortSerial takes an id consisting of the first, sequential half of a
 // serial number and returns the first certificate whose full serial number is
 // lexically greater than that id. This allows clients to query on the known
@@ -220,6 +323,15 @@ func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate,
 	return *certPtr, err
 }
 
+// GetCertificatesByRegistration returns a page of the certificates issued to
+// a registration, ordered by serial.
+func (ssa *SQLStorageAuthority) GetCertificatesByRegistration(regID int64, offset, limit int) (certs []core.Certificate, err error) {
+	_, err = ssa.dbMap.Select(&certs, "SELECT * FROM certificates WHERE registrationID = :regID "+
+		"ORDER BY serial LIMIT :limit OFFSET :offset",
+		map[string]interface{}{"regID": regID, "limit": limit, "offset": offset})
+	return
+}
+
 // GetCertificateStatus takes a hexadecimal string representing the full 128-bit serial
 // number of a certificate and returns data about that certificate's current
 // validity.
@@ -245,6 +357,9 @@ func (ssa *SQLStorageAuthority) NewRegistration(reg core.Registration) (core.Reg
 		return reg, err
 	}
 
+	createdAt := time.Now()
+	reg.CreatedAt = &createdAt
+
 	err = tx.Insert(&reg)
 	if err != nil {
 		tx.Rollback()
@@ -363,6 +478,175 @@ func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) (err e
 	return
 }
 
+// UpdateRegistrationKey replaces the account key of an existing Registration
+func (ssa *SQLStorageAuthority) UpdateRegistrationKey(id int64, key jose.JsonWebKey) (err error) {
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return
+	}
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	regObj, err := tx.Get(core.Registration{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if regObj == nil {
+		err = fmt.Errorf("Requested registration not found %v", id)
+		tx.Rollback()
+		return
+	}
+
+	var count int64
+	err = tx.SelectOne(&count, "SELECT count(*) FROM registrations WHERE jwk = :key",
+		map[string]interface{}{"key": string(keyJSON)})
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Key is already in use by another registration")
+		tx.Rollback()
+		return
+	}
+
+	reg := regObj.(*core.Registration)
+	reg.Key = key
+	_, err = tx.Update(reg)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// DeactivateRegistration marks a Registration as deactivated and invalidates
+// its pending authorizations. The registration itself is kept, so its key
+// remains reserved.
+func (ssa *SQLStorageAuthority) DeactivateRegistration(id int64) (err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	regObj, err := tx.Get(core.Registration{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if regObj == nil {
+		err = fmt.Errorf("Requested registration not found %v", id)
+		tx.Rollback()
+		return
+	}
+	reg := regObj.(*core.Registration)
+	reg.Status = core.StatusDeactivated
+	_, err = tx.Update(reg)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	var pending []pendingauthzModel
+	_, err = tx.Select(&pending, "SELECT * FROM pending_authz WHERE registrationID = :regID",
+		map[string]interface{}{"regID": id})
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	for i := range pending {
+		err = moveToFinal(tx, &pending[i], core.StatusInvalid)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// moveToFinal moves a pending authorization to the final authz table with
+// the given status, as FinalizeAuthorization does.
+func moveToFinal(tx *gorp.Transaction, pending *pendingauthzModel, status core.AcmeStatus) (err error) {
+	var sequence int64
+	sequenceObj, err := tx.SelectNullInt("SELECT max(sequence) FROM authz")
+	if err != nil {
+		return
+	}
+	if sequenceObj.Valid {
+		sequence = sequenceObj.Int64 + 1
+	}
+
+	authz := pending.Authorization
+	authz.Status = status
+	err = tx.Insert(&authzModel{Authorization: authz, Sequence: sequence})
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Delete(pending)
+	return
+}
+
+// DeactivateAuthorization marks a pending or valid Authorization as
+// deactivated. Pending authorizations are moved to the final table, as no
+// further updates to them are allowed.
+func (ssa *SQLStorageAuthority) DeactivateAuthorization(id string) (err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	authObj, err := tx.Get(pendingauthzModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if authObj != nil {
+		err = moveToFinal(tx, authObj.(*pendingauthzModel), core.StatusDeactivated)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+		return
+	}
+
+	authObj, err = tx.Get(authzModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if authObj == nil {
+		err = fmt.Errorf("No pending_authz or authz with ID %s", id)
+		tx.Rollback()
+		return
+	}
+	auth := authObj.(*authzModel)
+	if auth.Status != core.StatusValid {
+		err = fmt.Errorf("Cannot deactivate an authorization with status %s", auth.Status)
+		tx.Rollback()
+		return
+	}
+	auth.Status = core.StatusDeactivated
+	_, err = tx.Update(auth)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
 // NewPendingAuthorization stores a new Pending Authorization
 func (ssa *SQLStorageAuthority) NewPendingAuthorization(authz core.Authorization) (output core.Authorization, err error) {
 	tx, err := ssa.dbMap.Begin()
@@ -431,6 +715,63 @@ func (ssa *SQLStorageAuthority) UpdatePendingAuthorization(authz core.Authorizat
 	return
 }
 
+// UpdatePendingChallenge records a change to one challenge of a pending
+// authorization and returns the authorization as stored. The challenge is
+// merged into the stored authorization in the same transaction that reads
+// it, and the merge is retried if another update got there first, so
+// concurrent updates to different challenges don't overwrite each other. A
+// challenge that has already been validated or has failed is left as it is.
+func (ssa *SQLStorageAuthority) UpdatePendingChallenge(id string, index int, challenge core.Challenge) (authz core.Authorization, err error) {
+	for attempt := 0; attempt < maxChallengeUpdateAttempts; attempt++ {
+		authz, err = ssa.updatePendingChallenge(id, index, challenge)
+		if _, ok := err.(gorp.OptimisticLockError); !ok {
+			return
+		}
+	}
+	return
+}
+
+func (ssa *SQLStorageAuthority) updatePendingChallenge(id string, index int, challenge core.Challenge) (authz core.Authorization, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	authObj, err := tx.Get(pendingauthzModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if authObj == nil {
+		err = errors.New("Requested authorization not found " + id)
+		tx.Rollback()
+		return
+	}
+	auth := authObj.(*pendingauthzModel)
+	if index < 0 || index >= len(auth.Challenges) {
+		err = fmt.Errorf("Invalid challenge index: %d", index)
+		tx.Rollback()
+		return
+	}
+
+	switch auth.Challenges[index].Status {
+	case core.StatusValid, core.StatusInvalid:
+		authz = auth.Authorization
+		err = tx.Commit()
+		return
+	}
+	auth.Challenges[index] = challenge
+	_, err = tx.Update(auth)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	authz = auth.Authorization
+	err = tx.Commit()
+	return
+}
+
 // FinalizeAuthorization converts a Pending Authorization to a final one
 func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization) (err error) {
 	tx, err := ssa.dbMap.Begin()
@@ -462,7 +803,11 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 		sequence += sequenceObj.Int64 + 1
 	}
 
-	auth := &authzModel{authz, sequence}
+	auth := &authzModel{Authorization: authz, Sequence: sequence}
+	if authz.Status == core.StatusInvalid {
+		now := time.Now()
+		auth.Failed = &now
+	}
 	authObj, err := tx.Get(pendingauthzModel{}, authz.ID)
 	if err != nil {
 		tx.Rollback()
@@ -486,6 +831,95 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 	return
 }
 
+// NewOrder stores a new Order, giving it an ID
+func (ssa *SQLStorageAuthority) NewOrder(order core.Order) (output core.Order, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	// Check that it doesn't exist already
+	order.ID = core.NewToken()
+	for existingOrder(tx, order.ID) {
+		order.ID = core.NewToken()
+	}
+
+	err = tx.Insert(&order)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	output = order
+	return
+}
+
+// GetOrder obtains an Order by ID
+func (ssa *SQLStorageAuthority) GetOrder(id string) (order core.Order, err error) {
+	orderObj, err := ssa.dbMap.Get(core.Order{}, id)
+	if err != nil {
+		return
+	}
+	if orderObj == nil {
+		err = fmt.Errorf("No order with ID %s", id)
+		return
+	}
+	order = *orderObj.(*core.Order)
+	return
+}
+
+// GetPendingOrders returns the orders belonging to a registration that have
+// not yet been finalized, i.e. those that are pending or ready.
+func (ssa *SQLStorageAuthority) GetPendingOrders(regID int64) (orders []core.Order, err error) {
+	_, err = ssa.dbMap.Select(&orders, "SELECT * FROM orders "+
+		"WHERE registrationID = :regID AND status IN ('pending', 'ready') ORDER BY id",
+		map[string]interface{}{"regID": regID})
+	return
+}
+
+// UpdateOrder stores an updated Order, provided the stored order still has
+// the given status. The status is compared and changed in a single
+// statement, so of several concurrent updates from the same status only one
+// succeeds. Orders that have become valid or invalid cannot be changed.
+func (ssa *SQLStorageAuthority) UpdateOrder(order core.Order, status core.AcmeStatus) (err error) {
+	if status == core.StatusValid || status == core.StatusInvalid {
+		err = fmt.Errorf("Cannot update an order with status %s", status)
+		return
+	}
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	result, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+		string(order.Status), order.ID, string(status))
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if rows != 1 {
+		err = fmt.Errorf("No order %s with status %s", order.ID, status)
+		tx.Rollback()
+		return
+	}
+
+	_, err = tx.Update(&order)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
 // AddCertificate stores an issued certificate.
 func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (digest string, err error) {
 	var parsedCertificate *x509.Certificate
@@ -532,10 +966,115 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		return
 	}
 
+	// Index the certificate's names for rate limiting
+	for _, name := range core.UniqueNames(parsedCertificate.DNSNames) {
+		err = tx.Insert(&issuedNameModel{
+			ReversedName: reverseName(name),
+			Serial:       serial,
+			Issued:       cert.Issued,
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	if len(parsedCertificate.DNSNames) > 0 {
+		err = tx.Insert(&fqdnSetModel{
+			SetHash: hashNames(parsedCertificate.DNSNames),
+			Serial:  serial,
+			Issued:  cert.Issued,
+			Expires: cert.Expires,
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
 	err = tx.Commit()
 	return
 }
 
+// CountCertificatesByNames counts, for each of the given domains, the
+// certificates issued between earliest and latest for the domain or any of
+// its subdomains.
+func (ssa *SQLStorageAuthority) CountCertificatesByNames(domains []string, earliest, latest time.Time) (counts map[string]int, err error) {
+	counts = make(map[string]int, len(domains))
+	for _, domain := range domains {
+		reversed := reverseName(domain)
+		var count int64
+		count, err = ssa.dbMap.SelectInt("SELECT COUNT(DISTINCT serial) FROM issuedNames "+
+			"WHERE (reversedName = :reversed OR reversedName LIKE :subdomains) "+
+			"AND issued > :earliest AND issued <= :latest",
+			map[string]interface{}{
+				"reversed":   reversed,
+				"subdomains": reversed + ".%",
+				"earliest":   earliest,
+				"latest":     latest,
+			})
+		if err != nil {
+			return
+		}
+		counts[domain] = int(count)
+	}
+	return
+}
+
+// CountRegistrationsByIP counts the registrations created from an IP address
+// between earliest and latest.
+func (ssa *SQLStorageAuthority) CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (int, error) {
+	count, err := ssa.dbMap.SelectInt("SELECT COUNT(*) FROM registrations "+
+		"WHERE initialIp = :ip AND createdAt > :earliest AND createdAt <= :latest",
+		map[string]interface{}{
+			"ip":       []byte(ip.To16()),
+			"earliest": earliest,
+			"latest":   latest,
+		})
+	return int(count), err
+}
+
+// CountPendingAuthorizations counts the unexpired pending authorizations
+// belonging to a registration.
+func (ssa *SQLStorageAuthority) CountPendingAuthorizations(regID int64) (int, error) {
+	count, err := ssa.dbMap.SelectInt("SELECT COUNT(*) FROM pending_authz "+
+		"WHERE registrationID = :regID AND (expires IS NULL OR expires > :now)",
+		map[string]interface{}{
+			"regID": regID,
+			"now":   time.Now(),
+		})
+	return int(count), err
+}
+
+// CountInvalidAuthorizations counts the authorizations for an identifier
+// belonging to a registration that failed between earliest and latest.
+func (ssa *SQLStorageAuthority) CountInvalidAuthorizations(regID int64, identifier core.AcmeIdentifier, earliest, latest time.Time) (int, error) {
+	ident, err := json.Marshal(identifier)
+	if err != nil {
+		return 0, err
+	}
+	count, err := ssa.dbMap.SelectInt("SELECT COUNT(*) FROM authz "+
+		"WHERE registrationID = :regID AND identifier = :identifier AND status = 'invalid' "+
+		"AND failed > :earliest AND failed <= :latest",
+		map[string]interface{}{
+			"regID":      regID,
+			"identifier": string(ident),
+			"earliest":   earliest,
+			"latest":     latest,
+		})
+	return int(count), err
+}
+
+// CountFQDNSets counts the certificates issued within the window for exactly
+// the given set of names.
+func (ssa *SQLStorageAuthority) CountFQDNSets(window time.Duration, names []string) (count int64, err error) {
+	count, err = ssa.dbMap.SelectInt("SELECT COUNT(*) FROM fqdnSets WHERE setHash = :setHash AND issued > :since",
+		map[string]interface{}{
+			"setHash": hashNames(names),
+			"since":   time.Now().Add(-window),
+		})
+	return
+}
+
 // AlreadyDeniedCSR queries to find if the name list has already been denied.
 func (ssa *SQLStorageAuthority) AlreadyDeniedCSR(names []string) (already bool, err error) {
 	sort.Strings(names)
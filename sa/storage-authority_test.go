@@ -12,7 +12,10 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"net"
 	"net/url"
+	"sort"
 	"time"
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
@@ -90,6 +93,134 @@ func TestAddRegistration(t *testing.T) {
 	test.AssertError(t, err, "Registration object for invalid key was returned")
 }
 
+func TestUpdateRegistrationKey(t *testing.T) {
+	sa := initSA(t)
+
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(theKey), &jwk)
+	test.AssertNotError(t, err, "JSON unmarshal error")
+	reg, err := sa.NewRegistration(core.Registration{Key: jwk})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	newJWK := jose.JsonWebKey{Key: &newKey.PublicKey}
+
+	err = sa.UpdateRegistrationKey(reg.ID+1, newJWK)
+	test.AssertError(t, err, "Updated key of missing registration")
+
+	err = sa.UpdateRegistrationKey(reg.ID, newJWK)
+	test.AssertNotError(t, err, "Couldn't update registration key")
+
+	dbReg, err := sa.GetRegistrationByKey(newJWK)
+	test.AssertNotError(t, err, "Couldn't get registration by new key")
+	test.AssertEquals(t, dbReg.ID, reg.ID)
+	_, err = sa.GetRegistrationByKey(jwk)
+	test.AssertError(t, err, "Registration still found by old key")
+
+	other, err := sa.NewRegistration(core.Registration{Key: jwk})
+	test.AssertNotError(t, err, "Couldn't create second registration")
+	err = sa.UpdateRegistrationKey(other.ID, newJWK)
+	test.AssertError(t, err, "Reused key of another registration")
+}
+
+func TestDeactivateRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(theKey), &jwk)
+	test.AssertNotError(t, err, "JSON unmarshal error")
+	reg, err := sa.NewRegistration(core.Registration{Key: jwk, Status: core.StatusValid})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+
+	pending, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: reg.ID, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+	other, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: reg.ID + 1, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+
+	err = sa.DeactivateRegistration(reg.ID + 2)
+	test.AssertError(t, err, "Deactivated missing registration")
+
+	err = sa.DeactivateRegistration(reg.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate registration")
+
+	// The key stays reserved
+	dbReg, err := sa.GetRegistrationByKey(jwk)
+	test.AssertNotError(t, err, "Couldn't get registration by key")
+	test.AssertEquals(t, dbReg.ID, reg.ID)
+	test.AssertEquals(t, dbReg.Status, core.StatusDeactivated)
+
+	authz, err := sa.GetAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't get invalidated authorization")
+	test.AssertEquals(t, authz.Status, core.StatusInvalid)
+	err = sa.UpdatePendingAuthorization(pending)
+	test.AssertError(t, err, "Updated invalidated authorization")
+
+	authz, err = sa.GetAuthorization(other.ID)
+	test.AssertNotError(t, err, "Couldn't get other registration's authorization")
+	test.AssertEquals(t, authz.Status, core.StatusPending)
+}
+
+func TestCountRegistrationsByIP(t *testing.T) {
+	sa := initSA(t)
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.1", "2001:db8::1"} {
+		key, err := rsa.GenerateKey(rand.Reader, 512)
+		test.AssertNotError(t, err, "Couldn't generate key")
+		_, err = sa.NewRegistration(core.Registration{
+			Key:       jose.JsonWebKey{Key: &key.PublicKey},
+			InitialIP: net.ParseIP(ip),
+		})
+		test.AssertNotError(t, err, "Couldn't create new registration")
+	}
+
+	now := time.Now()
+	count, err := sa.CountRegistrationsByIP(net.ParseIP("192.0.2.1"), now.Add(-time.Hour), now)
+	test.AssertNotError(t, err, "Couldn't count registrations")
+	test.AssertEquals(t, count, 2)
+	count, err = sa.CountRegistrationsByIP(net.ParseIP("2001:db8::1"), now.Add(-time.Hour), now)
+	test.AssertNotError(t, err, "Couldn't count registrations")
+	test.AssertEquals(t, count, 1)
+	count, err = sa.CountRegistrationsByIP(net.ParseIP("192.0.2.1"), now.Add(-2*time.Hour), now.Add(-time.Hour))
+	test.AssertNotError(t, err, "Couldn't count registrations")
+	test.AssertEquals(t, count, 0)
+}
+
+func TestCountAuthorizations(t *testing.T) {
+	sa := initSA(t)
+
+	CreateDomainAuth(t, "example.com", sa)
+	CreateDomainAuth(t, "example.org", sa)
+	count, err := sa.CountPendingAuthorizations(42)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, 2)
+
+	// Failures are counted by when they happened, not when they expire
+	failed := CreateDomainAuth(t, "example.net", sa)
+	failedAt := time.Now()
+	expires := failedAt.Add(7 * 24 * time.Hour)
+	failed.Status = core.StatusInvalid
+	failed.Expires = &expires
+	err = sa.FinalizeAuthorization(failed)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+
+	count, err = sa.CountPendingAuthorizations(42)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, 2)
+	count, err = sa.CountInvalidAuthorizations(42, failed.Identifier, failedAt.Add(-time.Hour), failedAt.Add(time.Second))
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 1)
+	count, err = sa.CountInvalidAuthorizations(43, failed.Identifier, failedAt.Add(-time.Hour), failedAt.Add(time.Second))
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 0)
+	count, err = sa.CountInvalidAuthorizations(42, failed.Identifier, expires.Add(-time.Hour), expires.Add(time.Second))
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 0)
+	dbAuthz, err := sa.GetAuthorization(failed.ID)
+	test.AssertNotError(t, err, "Couldn't get invalid authorization")
+	test.Assert(t, dbAuthz.Expires.Equal(expires), "Expiry of invalid authorization changed")
+}
+
 func TestAddAuthorization(t *testing.T) {
 	sa := initSA(t)
 
@@ -132,6 +263,161 @@ func TestAddAuthorization(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't get authorization with ID "+PA.ID)
 }
 
+func TestUpdatePendingAuthorizationRepeatedly(t *testing.T) {
+	sa := initSA(t)
+	authz := CreateDomainAuth(t, "example.com", sa)
+	authz.Challenges = append(authz.Challenges, core.Challenge{Type: "dns", Status: core.StatusPending, Token: "ANOTHERBADTOKEN"})
+	authz.Challenges[0].Status = core.StatusPending
+
+	for i := range authz.Challenges {
+		authz.Challenges[i].Status = core.StatusValid
+		err := sa.UpdatePendingAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't update pending authorization")
+
+		dbAuthz, err := sa.GetAuthorization(authz.ID)
+		test.AssertNotError(t, err, "Couldn't get pending authorization")
+		test.AssertEquals(t, dbAuthz.Status, core.StatusPending)
+		test.AssertEquals(t, dbAuthz.Challenges[i].Status, core.StatusValid)
+	}
+}
+
+func TestUpdatePendingChallenge(t *testing.T) {
+	sa := initSA(t)
+	authz := CreateDomainAuth(t, "example.com", sa)
+	authz.Challenges = append(authz.Challenges, core.Challenge{Type: "dns", Status: core.StatusPending, Token: "ANOTHERBADTOKEN"})
+	authz.Challenges[0].Status = core.StatusPending
+	err := sa.UpdatePendingAuthorization(authz)
+	test.AssertNotError(t, err, "Couldn't update pending authorization")
+
+	// Updates from stale copies each change only their own challenge
+	first := authz.Challenges[0]
+	first.Status = core.StatusValid
+	second := authz.Challenges[1]
+	second.Status = core.StatusInvalid
+	_, err = sa.UpdatePendingChallenge(authz.ID, 0, first)
+	test.AssertNotError(t, err, "Couldn't update pending challenge")
+	stored, err := sa.UpdatePendingChallenge(authz.ID, 1, second)
+	test.AssertNotError(t, err, "Couldn't update pending challenge")
+	test.AssertEquals(t, stored.Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, stored.Challenges[1].Status, core.StatusInvalid)
+
+	// A finished challenge is left as it is
+	first.Status = core.StatusPending
+	stored, err = sa.UpdatePendingChallenge(authz.ID, 0, first)
+	test.AssertNotError(t, err, "Couldn't update pending challenge")
+	test.AssertEquals(t, stored.Challenges[0].Status, core.StatusValid)
+	dbAuthz, err := sa.GetAuthorization(authz.ID)
+	test.AssertNotError(t, err, "Couldn't get pending authorization")
+	test.AssertEquals(t, dbAuthz.Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, dbAuthz.Challenges[1].Status, core.StatusInvalid)
+
+	_, err = sa.UpdatePendingChallenge(authz.ID, 2, first)
+	test.AssertError(t, err, "Updated challenge out of range")
+	_, err = sa.UpdatePendingChallenge("missing", 0, first)
+	test.AssertError(t, err, "Updated challenge of missing authorization")
+}
+
+func TestDeactivateAuthorization(t *testing.T) {
+	sa := initSA(t)
+
+	// Pending authorizations are moved to the final table
+	pending := CreateDomainAuth(t, "example.com", sa)
+	err := sa.DeactivateAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate pending authorization")
+	authz, err := sa.GetAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't get deactivated authorization")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	err = sa.UpdatePendingAuthorization(pending)
+	test.AssertError(t, err, "Updated deactivated authorization")
+
+	// Valid authorizations stop being returned for issuance
+	valid := CreateDomainAuth(t, "example.org", sa)
+	valid.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(valid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	_, err = sa.GetLatestValidAuthorization(42, valid.Identifier)
+	test.AssertNotError(t, err, "Couldn't get valid authorization")
+
+	err = sa.DeactivateAuthorization(valid.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate valid authorization")
+	authz, err = sa.GetAuthorization(valid.ID)
+	test.AssertNotError(t, err, "Couldn't get deactivated authorization")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	_, err = sa.GetLatestValidAuthorization(42, valid.Identifier)
+	test.AssertError(t, err, "Deactivated authorization still valid")
+
+	// Other final authorizations can't be deactivated
+	err = sa.DeactivateAuthorization(valid.ID)
+	test.AssertError(t, err, "Deactivated authorization twice")
+	err = sa.DeactivateAuthorization("missing")
+	test.AssertError(t, err, "Deactivated missing authorization")
+}
+
+func TestOrders(t *testing.T) {
+	sa := initSA(t)
+
+	exp := time.Now().AddDate(0, 0, 7)
+	order, err := sa.NewOrder(core.Order{
+		RegistrationID: 42,
+		Status:         core.StatusPending,
+		Expires:        &exp,
+		Identifiers:    []core.AcmeIdentifier{{Type: core.IdentifierDNS, Value: "example.com"}},
+		Authorizations: []string{"authz-a"},
+	})
+	test.AssertNotError(t, err, "Couldn't create new order")
+	test.Assert(t, order.ID != "", "ID shouldn't be blank")
+
+	dbOrder, err := sa.GetOrder(order.ID)
+	test.AssertNotError(t, err, "Couldn't get order with ID "+order.ID)
+	test.AssertEquals(t, dbOrder.RegistrationID, int64(42))
+	test.AssertEquals(t, len(dbOrder.Identifiers), 1)
+	test.AssertEquals(t, dbOrder.Identifiers[0].Value, "example.com")
+	test.AssertEquals(t, dbOrder.Authorizations[0], "authz-a")
+	_, err = sa.GetOrder("missing")
+	test.AssertError(t, err, "Got missing order")
+
+	orders, err := sa.GetPendingOrders(42)
+	test.AssertNotError(t, err, "Couldn't get pending orders")
+	test.AssertEquals(t, len(orders), 1)
+
+	// Orders stay pending while ready, and can't change once invalid
+	order.Status = core.StatusReady
+	err = sa.UpdateOrder(order, core.StatusPending)
+	test.AssertNotError(t, err, "Couldn't update order")
+	orders, err = sa.GetPendingOrders(42)
+	test.AssertNotError(t, err, "Couldn't get pending orders")
+	test.AssertEquals(t, len(orders), 1)
+	test.AssertEquals(t, orders[0].Status, core.StatusReady)
+
+	// Only one of several updates from the same status succeeds
+	order.Status = core.StatusProcessing
+	err = sa.UpdateOrder(order, core.StatusReady)
+	test.AssertNotError(t, err, "Couldn't start processing order")
+	err = sa.UpdateOrder(order, core.StatusReady)
+	test.AssertError(t, err, "Started processing order twice")
+	order.Status = core.StatusReady
+	err = sa.UpdateOrder(order, core.StatusPending)
+	test.AssertError(t, err, "Updated order from a status it no longer has")
+	dbOrder, err = sa.GetOrder(order.ID)
+	test.AssertNotError(t, err, "Couldn't get order with ID "+order.ID)
+	test.AssertEquals(t, dbOrder.Status, core.StatusProcessing)
+
+	order.Status = core.StatusInvalid
+	order.Error = &core.ProblemDetails{Type: core.MalformedProblem, Detail: "bad CSR"}
+	err = sa.UpdateOrder(order, core.StatusProcessing)
+	test.AssertNotError(t, err, "Couldn't invalidate order")
+	dbOrder, err = sa.GetOrder(order.ID)
+	test.AssertNotError(t, err, "Couldn't get order with ID "+order.ID)
+	test.AssertEquals(t, dbOrder.Error.Detail, "bad CSR")
+	orders, err = sa.GetPendingOrders(42)
+	test.AssertNotError(t, err, "Couldn't get pending orders")
+	test.AssertEquals(t, len(orders), 0)
+
+	order.Status = core.StatusReady
+	err = sa.UpdateOrder(order, core.StatusInvalid)
+	test.AssertError(t, err, "Updated invalid order")
+}
+
 func CreateDomainAuth(t *testing.T, domainName string, sa *SQLStorageAuthority) (authz core.Authorization) {
 	// create pending auth
 	authz, err := sa.NewPendingAuthorization(core.Authorization{})
@@ -245,6 +531,133 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	test.AssertEquals(t, authz.ID, newAuthz.ID)
 }
 
+func TestGetAuthorizationsByIdentifier(t *testing.T) {
+	sa := initSA(t)
+	now := time.Now()
+
+	pending := CreateDomainAuth(t, "example.com", sa)
+	valid := CreateDomainAuth(t, "example.com", sa)
+	exp := now.AddDate(0, 0, 30)
+	valid.Status = core.StatusValid
+	valid.Expires = &exp
+	err := sa.FinalizeAuthorization(valid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	CreateDomainAuth(t, "example.org", sa)
+
+	authzs, err := sa.GetAuthorizationsByIdentifier(42, valid.Identifier, now)
+	test.AssertNotError(t, err, "Couldn't get authorizations by identifier")
+	test.AssertEquals(t, len(authzs), 2)
+	test.AssertEquals(t, authzs[0].ID, valid.ID)
+	test.AssertEquals(t, authzs[1].ID, pending.ID)
+
+	// The pending authorization expires in a day
+	authzs, err = sa.GetAuthorizationsByIdentifier(42, valid.Identifier, now.AddDate(0, 0, 2))
+	test.AssertNotError(t, err, "Couldn't get authorizations by identifier")
+	test.AssertEquals(t, len(authzs), 1)
+	test.AssertEquals(t, authzs[0].ID, valid.ID)
+
+	authzs, err = sa.GetAuthorizationsByIdentifier(43, valid.Identifier, now)
+	test.AssertNotError(t, err, "Couldn't get authorizations by identifier")
+	test.AssertEquals(t, len(authzs), 0)
+}
+
+func TestGetAuthorizationsByRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	var ids []string
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"} {
+		ids = append(ids, CreateDomainAuth(t, name, sa).ID)
+	}
+	// Finalized authorizations are listed alongside pending ones
+	for _, id := range ids[:2] {
+		authz, err := sa.GetAuthorization(id)
+		test.AssertNotError(t, err, "Couldn't get pending authorization")
+		authz.Status = core.StatusValid
+		err = sa.FinalizeAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	}
+	other := CreateDomainAuth(t, "other.example.com", sa)
+	other.RegistrationID = 43
+	err := sa.UpdatePendingAuthorization(other)
+	test.AssertNotError(t, err, "Couldn't update pending authorization")
+	sort.Strings(ids)
+
+	authzs, err := sa.GetAuthorizationsByRegistration(42, 0, 10)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 4)
+	for i, authz := range authzs {
+		test.AssertEquals(t, authz.ID, ids[i])
+		test.AssertEquals(t, authz.RegistrationID, int64(42))
+	}
+
+	authzs, err = sa.GetAuthorizationsByRegistration(42, 1, 2)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 2)
+	test.AssertEquals(t, authzs[0].ID, ids[1])
+	test.AssertEquals(t, authzs[1].ID, ids[2])
+
+	authzs, err = sa.GetAuthorizationsByRegistration(42, 3, 2)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 1)
+	test.AssertEquals(t, authzs[0].ID, ids[3])
+
+	authzs, err = sa.GetAuthorizationsByRegistration(42, 4, 2)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 0)
+
+	authzs, err = sa.GetAuthorizationsByRegistration(42, 0, 0)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 0)
+
+	authzs, err = sa.GetAuthorizationsByRegistration(43, 0, 10)
+	test.AssertNotError(t, err, "Couldn't get authorizations by registration")
+	test.AssertEquals(t, len(authzs), 1)
+	test.AssertEquals(t, authzs[0].ID, other.ID)
+}
+
+func TestGetCertificatesByRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	// Insert out of order to check the listing is sorted by serial
+	serials := []string{
+		"00000000000000000000000000000003",
+		"00000000000000000000000000000001",
+		"00000000000000000000000000000002",
+	}
+	for _, serial := range serials {
+		err := sa.dbMap.Insert(&core.Certificate{RegistrationID: 42, Serial: serial, Status: core.StatusValid})
+		test.AssertNotError(t, err, "Couldn't insert certificate")
+	}
+	err := sa.dbMap.Insert(&core.Certificate{RegistrationID: 43, Serial: "00000000000000000000000000000004", Status: core.StatusValid})
+	test.AssertNotError(t, err, "Couldn't insert certificate")
+	sort.Strings(serials)
+
+	certs, err := sa.GetCertificatesByRegistration(42, 0, 10)
+	test.AssertNotError(t, err, "Couldn't get certificates by registration")
+	test.AssertEquals(t, len(certs), 3)
+	for i, cert := range certs {
+		test.AssertEquals(t, cert.Serial, serials[i])
+	}
+
+	certs, err = sa.GetCertificatesByRegistration(42, 1, 1)
+	test.AssertNotError(t, err, "Couldn't get certificates by registration")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, certs[0].Serial, serials[1])
+
+	certs, err = sa.GetCertificatesByRegistration(42, 2, 5)
+	test.AssertNotError(t, err, "Couldn't get certificates by registration")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, certs[0].Serial, serials[2])
+
+	certs, err = sa.GetCertificatesByRegistration(42, 3, 5)
+	test.AssertNotError(t, err, "Couldn't get certificates by registration")
+	test.AssertEquals(t, len(certs), 0)
+
+	certs, err = sa.GetCertificatesByRegistration(44, 0, 10)
+	test.AssertNotError(t, err, "Couldn't get certificates by registration")
+	test.AssertEquals(t, len(certs), 0)
+}
+
 func TestAddCertificate(t *testing.T) {
 	sa := initSA(t)
 
@@ -295,6 +708,51 @@ func TestAddCertificate(t *testing.T) {
 	test.Assert(t, certificateStatus2.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 }
 
+// addTestCertificate adds a self-signed certificate for the names, issued to
+// registration 1.
+func addTestCertificate(t *testing.T, sa *SQLStorageAuthority, serial int64, names ...string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(0, 0, 90),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	_, err = sa.AddCertificate(certDER, 1)
+	test.AssertNotError(t, err, "Couldn't add certificate")
+}
+
+func TestCountCertificates(t *testing.T) {
+	sa := initSA(t)
+
+	addTestCertificate(t, sa, 1, "example.com", "www.example.com")
+	addTestCertificate(t, sa, 2, "WWW.example.com", "example.com")
+	addTestCertificate(t, sa, 3, "mail.example.com")
+	addTestCertificate(t, sa, 4, "notexample.com")
+
+	now := time.Now()
+	counts, err := sa.CountCertificatesByNames([]string{"example.com", "mail.example.com", "example.org"}, now.Add(-time.Hour), now)
+	test.AssertNotError(t, err, "Couldn't count certificates by name")
+	test.AssertEquals(t, counts["example.com"], 3)
+	test.AssertEquals(t, counts["mail.example.com"], 1)
+	test.AssertEquals(t, counts["example.org"], 0)
+
+	counts, err = sa.CountCertificatesByNames([]string{"example.com"}, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	test.AssertNotError(t, err, "Couldn't count certificates by name")
+	test.AssertEquals(t, counts["example.com"], 0)
+
+	count, err := sa.CountFQDNSets(time.Hour, []string{"www.example.com", "example.com"})
+	test.AssertNotError(t, err, "Couldn't count FQDN sets")
+	test.AssertEquals(t, count, int64(2))
+	count, err = sa.CountFQDNSets(time.Hour, []string{"example.com"})
+	test.AssertNotError(t, err, "Couldn't count FQDN sets")
+	test.AssertEquals(t, count, int64(0))
+}
+
 // TestGetCertificateByShortSerial tests some failure conditions for GetCertificate.
 // Success conditions are tested above in TestAddCertificate.
 func TestGetCertificateByShortSerial(t *testing.T) {
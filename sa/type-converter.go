@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
@@ -22,7 +23,7 @@ type BoulderTypeConverter struct{}
 // ToDb converts a Boulder object to one suitable for the DB representation.
 func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 	switch t := val.(type) {
-	case core.AcmeIdentifier, []core.Challenge, []core.AcmeURL, [][]int:
+	case core.AcmeIdentifier, []core.Challenge, []core.AcmeURL, [][]int, []core.AcmeIdentifier, []string, *core.ProblemDetails:
 		jsonBytes, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
@@ -40,6 +41,8 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 		return string(t), nil
 	case core.JSONBuffer:
 		return []byte(t), nil
+	case net.IP:
+		return []byte(t.To16()), nil
 	default:
 		return val, nil
 	}
@@ -48,7 +51,7 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 // FromDb converts a DB representation back into a Boulder object.
 func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, bool) {
 	switch target.(type) {
-	case *core.AcmeIdentifier, *[]core.Challenge, *[]core.AcmeURL, *[][]int, core.JSONBuffer:
+	case *core.AcmeIdentifier, *[]core.Challenge, *[]core.AcmeURL, *[][]int, *[]core.AcmeIdentifier, *[]string, **core.ProblemDetails, core.JSONBuffer:
 		binder := func(holder, target interface{}) error {
 			s, ok := holder.(*string)
 			if !ok {
@@ -105,6 +108,21 @@ func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, b
 			return nil
 		}
 		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *net.IP:
+		binder := func(holder, target interface{}) error {
+			b, ok := holder.(*[]byte)
+			if !ok {
+				return fmt.Errorf("FromDb: Unable to convert %T to *[]byte", holder)
+			}
+			ip, ok := target.(*net.IP)
+			if !ok {
+				return fmt.Errorf("FromDb: Unable to convert %T to *net.IP", target)
+			}
+
+			*ip = net.IP(*b)
+			return nil
+		}
+		return gorp.CustomScanner{Holder: new([]byte), Target: target, Binder: binder}, true
 	default:
 		return gorp.CustomScanner{}, false
 	}
@@ -0,0 +1,13 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build !go1.5
+
+package va
+
+// Before Go 1.5, crypto/x509 fails to parse any certificate carrying an
+// unknown critical extension, so every tls-alpn-01 handshake would fail on
+// the critical acmeIdentifier extension. Refuse to build instead.
+var _ = tlsALPN01RequiresGo15OrLater
@@ -9,10 +9,13 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -70,6 +73,9 @@ func verifyValidationJWS(validation *jose.JsonWebSignature, accountKey *jose.Jso
 	if len(validation.Signatures) == 0 {
 		return fmt.Errorf("Validation JWS not signed")
 	}
+	if err := core.CheckJWSAlgorithm(accountKey, validation.Signatures[0].Header.Algorithm); err != nil {
+		return err
+	}
 
 	payload, _, err := validation.Verify(accountKey)
 	if err != nil {
@@ -120,17 +126,21 @@ func setChallengeErrorFromDNSError(err error, challenge *core.Challenge) {
 func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
 	challenge := input
 
-	if identifier.Type != core.IdentifierDNS {
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.MalformedProblem,
-			Detail: "Identifier type for SimpleHTTP was not DNS",
+			Detail: "Identifier type for SimpleHTTP was not DNS or IP",
 		}
 
 		va.log.Debug(fmt.Sprintf("SimpleHTTP [%s] Identifier failure", identifier))
 		return challenge, challenge.Error
 	}
 	hostName := identifier.Value
+	if identifier.Type == core.IdentifierIP && strings.Contains(hostName, ":") {
+		// IPv6 literals must be bracketed in URLs
+		hostName = "[" + hostName + "]"
+	}
 
 	var scheme string
 	if input.TLS == nil || (input.TLS != nil && *input.TLS) {
@@ -250,13 +260,156 @@ func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentif
 	return challenge, nil
 }
 
+// Port and path at which http-01 key authorizations are served
+const (
+	http01Port       = "80"
+	http01TestPort   = "5002"
+	http01PathPrefix = "/.well-known/acme-challenge/"
+)
+
+// Longest key authorization response read from a server
+const maxKeyAuthorizationSize = 1024
+
+func (va ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for http-01 was not DNS or IP",
+		}
+		va.log.Debug(fmt.Sprintf("http-01 [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	expected, err := core.NewKeyAuthorization(challenge.Token, &accountKey)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: fmt.Sprintf("Could not compute key authorization: %s", err),
+		}
+		return challenge, err
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge.KeyAuthorization), []byte(expected)) != 1 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: "Key authorization in response does not match the account key",
+		}
+		return challenge, challenge.Error
+	}
+
+	// Key authorizations are only fetched over plain HTTP on port 80
+	port := http01Port
+	if va.TestMode {
+		port = http01TestPort
+	}
+	hostName := identifier.Value
+	if identifier.Type == core.IdentifierIP && strings.Contains(hostName, ":") {
+		// IPv6 literals must be bracketed in URLs
+		hostName = "[" + hostName + "]"
+	}
+	host := hostName
+	if va.TestMode {
+		host = "localhost:" + port
+	}
+	url := fmt.Sprintf("http://%s%s%s", host, http01PathPrefix, challenge.Token)
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.Audit(fmt.Sprintf("Attempting to validate http-01 for %s", url))
+	httpRequest, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "URL provided for http-01 was invalid",
+		}
+		va.log.Debug(fmt.Sprintf("http-01 [%s] HTTP failure: %s", identifier, err))
+		return challenge, err
+	}
+	if va.UserAgent != "" {
+		httpRequest.Header["User-Agent"] = []string{va.UserAgent}
+	}
+	httpRequest.Host = hostName
+
+	checkRedirect := func(req *http.Request, via []*http.Request) error {
+		va.log.Info(fmt.Sprintf("validateHTTP01 [%s] redirect from %q to %q", identifier, via[len(via)-1].URL.String(), req.URL.String()))
+		if len(via) >= 10 {
+			return errors.New("Too many redirects")
+		}
+		if req.URL.Scheme != "http" {
+			return fmt.Errorf("Redirect to %s is not over plain HTTP", req.URL)
+		}
+		if _, redirectPort, err := net.SplitHostPort(req.URL.Host); err == nil && redirectPort != port {
+			return fmt.Errorf("Redirect to %s is not to port %s", req.URL, port)
+		}
+		return nil
+	}
+	client := http.Client{
+		Transport: &http.Transport{
+			// We don't expect to make multiple requests to a client, so close
+			// connection immediately.
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: checkRedirect,
+		Timeout:       5 * time.Second,
+	}
+	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   parseHTTPConnError(err),
+			Detail: fmt.Sprintf("Could not connect to %s", url),
+		}
+		va.log.Debug(strings.Join([]string{challenge.Error.Error(), err.Error()}, ": "))
+		return challenge, err
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != 200 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type: core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Invalid response from %s: %d",
+				url, httpResponse.StatusCode),
+		}
+		return challenge, challenge.Error
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxKeyAuthorizationSize))
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: "Error reading HTTP response body",
+		}
+		return challenge, err
+	}
+
+	// Servers commonly append a newline to static files
+	served := strings.TrimSpace(string(body))
+	if subtle.ConstantTimeCompare([]byte(served), []byte(expected)) != 1 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("The key authorization file from %s did not match: expected %q, got %q", url, expected, served),
+		}
+		return challenge, challenge.Error
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
 func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
 	challenge := input
 
-	if identifier.Type != "dns" {
+	if identifier.Type != core.IdentifierDNS && identifier.Type != core.IdentifierIP {
 		challenge.Error = &core.ProblemDetails{
 			Type:   core.MalformedProblem,
-			Detail: "Identifier type for DVSNI was not DNS",
+			Detail: "Identifier type for DVSNI was not DNS or IP",
 		}
 		challenge.Status = core.StatusInvalid
 		va.log.Debug(fmt.Sprintf("DVSNI [%s] Identifier failure", identifier))
@@ -289,7 +442,7 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	ZName := fmt.Sprintf("%s.%s.%s", Z[:32], Z[32:], core.DVSNISuffix)
 
 	// Make a connection with SNI = nonceName
-	hostPort := identifier.Value + ":443"
+	hostPort := net.JoinHostPort(identifier.Value, "443")
 	if va.TestMode {
 		hostPort = "localhost:5001"
 	}
@@ -336,6 +489,134 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	return challenge, challenge.Error
 }
 
+// Port and application protocol used to validate tls-alpn-01 challenges
+const (
+	tlsALPN01Port     = "443"
+	tlsALPN01TestPort = "5003"
+	acmeTLS1Protocol  = "acme-tls/1"
+)
+
+// idPeAcmeIdentifier is the OID of the acmeIdentifier certificate extension,
+// which holds the SHA-256 digest of a tls-alpn-01 key authorization.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func (va ValidationAuthorityImpl) validateTLSALPN01(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for tls-alpn-01 was not DNS",
+		}
+		va.log.Debug(fmt.Sprintf("tls-alpn-01 [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	expected, err := core.NewKeyAuthorization(challenge.Token, &accountKey)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: fmt.Sprintf("Could not compute key authorization: %s", err),
+		}
+		return challenge, err
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge.KeyAuthorization), []byte(expected)) != 1 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: "Key authorization in response does not match the account key",
+		}
+		return challenge, challenge.Error
+	}
+	digest := sha256.Sum256([]byte(expected))
+
+	// Unlike DVSNI, the SNI is the name being validated, so that load
+	// balancers can route the connection; only the ALPN protocol marks it as
+	// a validation request
+	hostPort := net.JoinHostPort(identifier.Value, tlsALPN01Port)
+	if va.TestMode {
+		hostPort = net.JoinHostPort("localhost", tlsALPN01TestPort)
+	}
+	va.log.Notice(fmt.Sprintf("tls-alpn-01 [%s] Attempting to validate tls-alpn-01 for %s", identifier, hostPort))
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", hostPort, &tls.Config{
+		ServerName:         identifier.Value,
+		NextProtos:         []string{acmeTLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   parseHTTPConnError(err),
+			Detail: "Failed to connect to host for tls-alpn-01 challenge",
+		}
+		va.log.Debug(fmt.Sprintf("tls-alpn-01 [%s] TLS Connection failure: %s", identifier, err))
+		return challenge, err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != acmeTLS1Protocol {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Server did not negotiate the %s protocol for tls-alpn-01 challenge", acmeTLS1Protocol),
+		}
+		return challenge, challenge.Error
+	}
+	if len(state.PeerCertificates) == 0 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: "No certs presented for tls-alpn-01 challenge",
+		}
+		return challenge, challenge.Error
+	}
+
+	if err = checkTLSALPN01Certificate(state.PeerCertificates[0], identifier.Value, digest[:]); err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Incorrect certificate for tls-alpn-01 challenge: %s", err),
+		}
+		return challenge, challenge.Error
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
+// checkTLSALPN01Certificate checks that a certificate is self-signed, names
+// only the identifier, and carries a critical acmeIdentifier extension with
+// the expected key authorization digest.
+func checkTLSALPN01Certificate(cert *x509.Certificate, name string, digest []byte) error {
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return errors.New("certificate is not self-signed")
+	}
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], name) {
+		return fmt.Errorf("expected a single DNS name %s, found %s", name, strings.Join(cert.DNSNames, ", "))
+	}
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		if !extension.Critical {
+			return errors.New("acmeIdentifier extension is not critical")
+		}
+		var value []byte
+		rest, err := asn1.Unmarshal(extension.Value, &value)
+		if err != nil || len(rest) > 0 {
+			return errors.New("malformed acmeIdentifier extension")
+		}
+		if subtle.ConstantTimeCompare(value, digest) != 1 {
+			return errors.New("acmeIdentifier extension has the wrong key authorization digest")
+		}
+		return nil
+	}
+	return errors.New("no acmeIdentifier extension")
+}
+
 // parseHTTPConnError returns the ACME ProblemType corresponding to an error
 // that occurred during domain validation.
 func parseHTTPConnError(err error) core.ProblemType {
@@ -416,6 +697,74 @@ func (va ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, in
 	return challenge, challenge.Error
 }
 
+func (va ValidationAuthorityImpl) validateDNS01(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for dns-01 was not DNS",
+		}
+		va.log.Debug(fmt.Sprintf("dns-01 [%s] Identifier failure", identifier))
+		return challenge, challenge.Error
+	}
+
+	expected, err := core.NewKeyAuthorization(challenge.Token, &accountKey)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.MalformedProblem,
+			Detail: fmt.Sprintf("Could not compute key authorization: %s", err),
+		}
+		return challenge, err
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge.KeyAuthorization), []byte(expected)) != 1 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: "Key authorization in response does not match the account key",
+		}
+		return challenge, challenge.Error
+	}
+
+	// The record holds a digest of the key authorization, which always fits in
+	// a single TXT string
+	digest := core.Fingerprint256([]byte(expected))
+
+	// Look for the required record in the DNS
+	challengeSubdomain := fmt.Sprintf("%s.%s", core.DNSPrefix, identifier.Value)
+	txts, _, err := va.DNSResolver.LookupTXT(challengeSubdomain)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		setChallengeErrorFromDNSError(err, &challenge)
+		va.log.Debug(fmt.Sprintf("%s [%s] DNS failure: %s", challenge.Type, identifier, err))
+		return challenge, challenge.Error
+	}
+
+	for _, element := range txts {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(element)), []byte(digest)) == 1 {
+			challenge.Status = core.StatusValid
+			return challenge, nil
+		}
+	}
+
+	detail := fmt.Sprintf("No TXT records found at %s", challengeSubdomain)
+	if len(txts) > 0 {
+		found := make([]string, len(txts))
+		for i, element := range txts {
+			found[i] = fmt.Sprintf("%q", element)
+		}
+		detail = fmt.Sprintf("Incorrect TXT record at %s: expected %q, found %s", challengeSubdomain, digest, strings.Join(found, ", "))
+	}
+	challenge.Status = core.StatusInvalid
+	challenge.Error = &core.ProblemDetails{
+		Type:   core.UnauthorizedProblem,
+		Detail: detail,
+	}
+	return challenge, challenge.Error
+}
+
 // Overall validation process
 
 func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int, accountKey jose.JsonWebKey) {
@@ -441,12 +790,21 @@ func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIn
 		case core.ChallengeTypeSimpleHTTP:
 			authz.Challenges[challengeIndex], err = va.validateSimpleHTTP(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
 			break
+		case core.ChallengeTypeHTTP01:
+			authz.Challenges[challengeIndex], err = va.validateHTTP01(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
+			break
 		case core.ChallengeTypeDVSNI:
 			authz.Challenges[challengeIndex], err = va.validateDvsni(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
 			break
 		case core.ChallengeTypeDNS:
 			authz.Challenges[challengeIndex], err = va.validateDNS(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
 			break
+		case core.ChallengeTypeDNS01:
+			authz.Challenges[challengeIndex], err = va.validateDNS01(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
+			break
+		case core.ChallengeTypeTLSALPN01:
+			authz.Challenges[challengeIndex], err = va.validateTLSALPN01(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
+			break
 		}
 
 		logEvent.Challenge = authz.Challenges[challengeIndex]
@@ -6,12 +6,15 @@
 package va
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -160,6 +163,44 @@ func simpleSrv(t *testing.T, token string, stopChan, waitChan chan bool, enableT
 	server.Serve(listener)
 }
 
+// http01Srv serves key authorizations for tokens, and redirects for the
+// pathMoved, pathFound and "https" tokens.
+func http01Srv(t *testing.T, keyAuthorizations map[string]string, stopChan, waitChan chan bool) {
+	m := http.NewServeMux()
+	m.HandleFunc("/.well-known/acme-challenge/", func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+		switch token {
+		case pathMoved:
+			http.Redirect(w, r, expectedToken, 301)
+		case pathFound:
+			http.Redirect(w, r, "https://localhost:5002/.well-known/acme-challenge/"+expectedToken, 302)
+		default:
+			keyAuthorization, present := keyAuthorizations[token]
+			if !present {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, "%s\n", keyAuthorization)
+		}
+	})
+
+	server := &http.Server{Addr: "localhost:5002", Handler: m}
+	conn, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		waitChan <- true
+		t.Errorf("Couldn't listen on %s: %s", server.Addr, err)
+		return
+	}
+
+	go func() {
+		<-stopChan
+		conn.Close()
+	}()
+
+	waitChan <- true
+	server.Serve(conn)
+}
+
 func dvsniSrv(t *testing.T, chall core.Challenge, stopChan, waitChan chan bool) {
 	encodedSig := core.B64enc(chall.Validation.Signatures[0].Signature)
 	h := sha256.New()
@@ -236,6 +277,108 @@ func brokenTLSSrv(t *testing.T, stopChan, waitChan chan bool) {
 	httpsServer.Serve(tlsListener)
 }
 
+// tlsALPN01Cert makes a self-signed certificate for a name with the given
+// extensions.
+func tlsALPN01Cert(t *testing.T, name string, extensions []pkix.Extension) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1337),
+		Subject: pkix.Name{
+			Organization: []string{"tests"},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+
+		DNSNames:        []string{name},
+		ExtraExtensions: extensions,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	return &tls.Certificate{
+		Certificate: [][]byte{certBytes},
+		PrivateKey:  key,
+	}
+}
+
+// tlsALPN01Srv serves the certificate for each SNI name, negotiating the
+// given application protocols. Once stopped, it signals waitChan again so the
+// port can be reused.
+func tlsALPN01Srv(t *testing.T, certs map[string]*tls.Certificate, protos []string, stopChan, waitChan chan bool) {
+	tlsConfig := &tls.Config{
+		ClientAuth: tls.NoClientCert,
+		GetCertificate: func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert, present := certs[clientHello.ServerName]; present {
+				return cert, nil
+			}
+			return nil, fmt.Errorf("No certificate for %s", clientHello.ServerName)
+		},
+		NextProtos: protos,
+	}
+
+	conn, err := net.Listen("tcp", "localhost:5003")
+	go func() {
+		<-stopChan
+		if conn != nil {
+			conn.Close()
+		}
+		waitChan <- true
+	}()
+
+	waitChan <- true
+	if err != nil {
+		t.Errorf("Couldn't listen on localhost:5003: %s", err)
+		return
+	}
+	tlsListener := tls.NewListener(conn, tlsConfig)
+	for {
+		clientConn, err := tlsListener.Accept()
+		if err != nil {
+			return
+		}
+		clientConn.(*tls.Conn).Handshake()
+		clientConn.Close()
+	}
+}
+
+func TestVerifyValidationJWSECDSA(t *testing.T) {
+	target := map[string]interface{}{
+		"type":  core.ChallengeTypeDNS,
+		"token": expectedToken,
+	}
+	payload, _ := json.Marshal(target)
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		test.AssertNotError(t, err, "Failed to generate key")
+		alg := jose.ES256
+		if curve == elliptic.P384() {
+			alg = jose.ES384
+		}
+		signer, err := jose.NewSigner(alg, key)
+		test.AssertNotError(t, err, "Failed to make signer")
+		signed, err := signer.Sign(payload, "")
+		test.AssertNotError(t, err, "Failed to sign validation")
+		obj, err := jose.ParseSigned(signed.FullSerialize())
+		test.AssertNotError(t, err, "Failed to parse validation")
+
+		accountKey := jose.JsonWebKey{Key: &key.PublicKey}
+		err = verifyValidationJWS(obj, &accountKey, target)
+		test.AssertNotError(t, err, fmt.Sprintf("Rejected validation signed with %s", alg))
+
+		// A different account key must not verify
+		otherKey, _ := ecdsa.GenerateKey(curve, rand.Reader)
+		otherAccountKey := jose.JsonWebKey{Key: &otherKey.PublicKey}
+		err = verifyValidationJWS(obj, &otherAccountKey, target)
+		test.AssertError(t, err, "Accepted validation signed by another key")
+	}
+}
+
 func TestSimpleHttpTLS(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
 	va.DNSResolver = &mocks.MockDNS{}
@@ -314,10 +457,17 @@ func TestSimpleHttp(t *testing.T) {
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/302" to ".*/301"`)), 1)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/301" to ".*/valid"`)), 1)
 
-	ipIdentifier := core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}
-	invalidChall, err = va.validateSimpleHTTP(ipIdentifier, chall, AccountKey)
+	log.Clear()
+	chall.Token = expectedToken
+	ipIdentifier := core.AcmeIdentifier{Type: core.IdentifierIP, Value: "127.0.0.1"}
+	finChall, err = va.validateSimpleHTTP(ipIdentifier, chall, AccountKey)
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertNotError(t, err, "IdentifierType IP should have worked.")
+
+	irisIdentifier := core.AcmeIdentifier{Type: core.IdentifierType("iris"), Value: "790DB180-A274-47A4-855F-31C428CB1072"}
+	invalidChall, err = va.validateSimpleHTTP(irisIdentifier, chall, AccountKey)
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
-	test.AssertError(t, err, "IdentifierType IP shouldn't have worked.")
+	test.AssertError(t, err, "IdentifierType IRIS shouldn't have worked.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
 
 	va.TestMode = false
@@ -339,6 +489,81 @@ func TestSimpleHttp(t *testing.T) {
 	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
 }
 
+func TestHTTP01(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+
+	chall := core.HTTPChallenge01()
+	keyAuthorization, err := core.NewKeyAuthorization(chall.Token, &AccountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+	chall.KeyAuthorization = keyAuthorization
+	thumbprint, err := core.Thumbprint(&AccountKey)
+	test.AssertNotError(t, err, "Couldn't thumbprint account key")
+
+	invalidChall, err := va.validateHTTP01(ident, chall, AccountKey)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Server's not up yet; expected refusal. Where did we connect?")
+	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
+
+	stopChan := make(chan bool, 1)
+	waitChan := make(chan bool, 1)
+	go http01Srv(t, map[string]string{
+		chall.Token:    keyAuthorization,
+		expectedToken:  expectedToken + "." + thumbprint,
+		pathWrongToken: keyAuthorization,
+	}, stopChan, waitChan)
+	defer func() { stopChan <- true }()
+	<-waitChan
+
+	log.Clear()
+	finChall, err := va.validateHTTP01(ident, chall, AccountKey)
+	test.AssertNotError(t, err, "Error validating http-01")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] `)), 1)
+
+	// The key authorization must be for the account key
+	otherKey := jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(1234567), E: 65537}}
+	invalidChall, err = va.validateHTTP01(ident, chall, otherKey)
+	test.AssertError(t, err, "Validated with another account's key")
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	// The response must match the key authorization
+	wrongChall := chall
+	wrongChall.KeyAuthorization = chall.Token + ".wrong"
+	invalidChall, err = va.validateHTTP01(ident, wrongChall, AccountKey)
+	test.AssertError(t, err, "Validated with the wrong key authorization")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+
+	// The server must serve the key authorization for the token
+	wrongChall = chall
+	wrongChall.Token = pathWrongToken
+	wrongChall.KeyAuthorization = pathWrongToken + "." + thumbprint
+	invalidChall, err = va.validateHTTP01(ident, wrongChall, AccountKey)
+	test.AssertError(t, err, "Validated with the wrong file served")
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	wrongChall.Token = path404
+	wrongChall.KeyAuthorization = path404 + "." + thumbprint
+	invalidChall, err = va.validateHTTP01(ident, wrongChall, AccountKey)
+	test.AssertError(t, err, "Should have found a 404 for the challenge.")
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	// Redirects are followed over plain HTTP only
+	log.Clear()
+	movedChall := chall
+	movedChall.Token = pathMoved
+	movedChall.KeyAuthorization = pathMoved + "." + thumbprint
+	invalidChall, err = va.validateHTTP01(ident, movedChall, AccountKey)
+	test.AssertError(t, err, "Redirect served the key authorization for another token")
+	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/301" to ".*/THETOKEN"`)), 1)
+
+	movedChall.Token = pathFound
+	movedChall.KeyAuthorization = pathFound + "." + thumbprint
+	invalidChall, err = va.validateHTTP01(ident, movedChall, AccountKey)
+	test.AssertError(t, err, "Followed a redirect to HTTPS")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+}
+
 func TestDvsni(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
 	va.DNSResolver = &mocks.MockDNS{}
@@ -360,9 +585,13 @@ func TestDvsni(t *testing.T) {
 	test.AssertEquals(t, finChall.Status, core.StatusValid)
 	test.AssertNotError(t, err, "")
 
-	invalidChall, err = va.validateDvsni(core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}, chall, AccountKey)
+	finChall, err = va.validateDvsni(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "127.0.0.1"}, chall, AccountKey)
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertNotError(t, err, "IdentifierType IP should have worked.")
+
+	invalidChall, err = va.validateDvsni(core.AcmeIdentifier{Type: core.IdentifierType("iris"), Value: "790DB180-A274-47A4-855F-31C428CB1072"}, chall, AccountKey)
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
-	test.AssertError(t, err, "IdentifierType IP shouldn't have worked.")
+	test.AssertError(t, err, "IdentifierType IRIS shouldn't have worked.")
 	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
 
 	va.TestMode = false
@@ -393,6 +622,111 @@ func TestDvsni(t *testing.T) {
 	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
 }
 
+func TestTLSALPN01(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	chall := core.TLSALPNChallenge01()
+	keyAuthorization, err := core.NewKeyAuthorization(chall.Token, &AccountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+	chall.KeyAuthorization = keyAuthorization
+
+	invalidChall, err := va.validateTLSALPN01(ident, chall, AccountKey)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Server's not up yet; expected refusal. Where did we connect?")
+	test.AssertEquals(t, invalidChall.Error.Type, core.ConnectionProblem)
+
+	digest := sha256.Sum256([]byte(keyAuthorization))
+	value, err := asn1.Marshal(digest[:])
+	test.AssertNotError(t, err, "Couldn't marshal digest")
+	wrongValue, err := asn1.Marshal(make([]byte, sha256.Size))
+	test.AssertNotError(t, err, "Couldn't marshal digest")
+	acmeIdentifier := pkix.Extension{Id: idPeAcmeIdentifier, Critical: true, Value: value}
+
+	certs := map[string]*tls.Certificate{
+		"localhost":              tlsALPN01Cert(t, "localhost", []pkix.Extension{acmeIdentifier}),
+		"wrong-digest.localhost": tlsALPN01Cert(t, "wrong-digest.localhost", []pkix.Extension{pkix.Extension{Id: idPeAcmeIdentifier, Critical: true, Value: wrongValue}}),
+		"not-critical.localhost": tlsALPN01Cert(t, "not-critical.localhost", []pkix.Extension{pkix.Extension{Id: idPeAcmeIdentifier, Value: value}}),
+		"no-extension.localhost": tlsALPN01Cert(t, "no-extension.localhost", nil),
+		"other-name.localhost":   tlsALPN01Cert(t, "localhost", []pkix.Extension{acmeIdentifier}),
+	}
+	waitChan := make(chan bool, 1)
+	stopChan := make(chan bool, 1)
+	go tlsALPN01Srv(t, certs, []string{acmeTLS1Protocol}, stopChan, waitChan)
+	defer func() {
+		stopChan <- true
+		<-waitChan
+	}()
+	<-waitChan
+
+	finChall, err := va.validateTLSALPN01(ident, chall, AccountKey)
+	test.AssertNotError(t, err, "Error validating tls-alpn-01")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+
+	var authz = core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+	va.validate(authz, 0, AccountKey)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusValid)
+
+	// The certificate must name the identifier and carry the right digest in
+	// a critical extension
+	for _, name := range []string{"wrong-digest.localhost", "not-critical.localhost", "no-extension.localhost", "other-name.localhost"} {
+		invalidChall, err = va.validateTLSALPN01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}, chall, AccountKey)
+		test.AssertError(t, err, fmt.Sprintf("Validated with the certificate for %s", name))
+		test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+		test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+	}
+
+	// The key authorization must be for the account key
+	otherKey := jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(1234567), E: 65537}}
+	invalidChall, err = va.validateTLSALPN01(ident, chall, otherKey)
+	test.AssertError(t, err, "Validated with another account's key")
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	invalidChall, err = va.validateTLSALPN01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "127.0.0.1"}, chall, AccountKey)
+	test.AssertError(t, err, "Validated an IP address through tls-alpn-01")
+	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
+}
+
+func TestTLSALPN01NoProtocol(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+
+	chall := core.TLSALPNChallenge01()
+	keyAuthorization, err := core.NewKeyAuthorization(chall.Token, &AccountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+	chall.KeyAuthorization = keyAuthorization
+
+	digest := sha256.Sum256([]byte(keyAuthorization))
+	value, err := asn1.Marshal(digest[:])
+	test.AssertNotError(t, err, "Couldn't marshal digest")
+	certs := map[string]*tls.Certificate{
+		"localhost": tlsALPN01Cert(t, "localhost", []pkix.Extension{pkix.Extension{Id: idPeAcmeIdentifier, Critical: true, Value: value}}),
+	}
+
+	// A server that doesn't speak acme-tls/1 isn't answering the challenge,
+	// even with the right certificate
+	waitChan := make(chan bool, 1)
+	stopChan := make(chan bool, 1)
+	go tlsALPN01Srv(t, certs, nil, stopChan, waitChan)
+	defer func() {
+		stopChan <- true
+		<-waitChan
+	}()
+	<-waitChan
+
+	invalidChall, err := va.validateTLSALPN01(ident, chall, AccountKey)
+	test.AssertError(t, err, "Validated without negotiating acme-tls/1")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+}
+
 func TestTLSError(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
 	va.DNSResolver = &mocks.MockDNS{}
@@ -746,6 +1080,72 @@ func TestDNSValidationNoServer(t *testing.T) {
 	test.AssertEquals(t, authz.Challenges[0].Error.Type, core.ConnectionProblem)
 }
 
+// txtDNS answers every TXT query with the same strings
+type txtDNS struct {
+	mocks.MockDNS
+	txts []string
+}
+
+func (mock *txtDNS) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	return mock.txts, 0, nil
+}
+
+func TestDNS01(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	chall := core.DNSChallenge01()
+	keyAuthorization, err := core.NewKeyAuthorization(chall.Token, &AccountKey)
+	test.AssertNotError(t, err, "Couldn't make key authorization")
+	chall.KeyAuthorization = keyAuthorization
+	digest := core.Fingerprint256([]byte(keyAuthorization))
+
+	// Any of the TXT strings may hold the digest
+	va.DNSResolver = &txtDNS{txts: []string{"unrelated", digest}}
+	finChall, err := va.validateDNS01(ident, chall, AccountKey)
+	test.AssertNotError(t, err, "Error validating dns-01")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+
+	var authz = core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+	va.validate(authz, 0, AccountKey)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusValid)
+
+	// The values found are reported
+	va.DNSResolver = &txtDNS{txts: []string{"unrelated", "stale"}}
+	invalidChall, err := va.validateDNS01(ident, chall, AccountKey)
+	test.AssertError(t, err, "Validated without the digest")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+	test.Assert(t, strings.Contains(invalidChall.Error.Detail, `found "unrelated", "stale"`), "Detail doesn't report the TXT records found")
+
+	va.DNSResolver = &txtDNS{}
+	invalidChall, err = va.validateDNS01(ident, chall, AccountKey)
+	test.AssertError(t, err, "Validated without TXT records")
+	test.AssertEquals(t, invalidChall.Error.Detail, "No TXT records found at _acme-challenge.localhost")
+
+	// The key authorization must be for the account key
+	va.DNSResolver = &txtDNS{txts: []string{digest}}
+	otherKey := jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(1234567), E: 65537}}
+	invalidChall, err = va.validateDNS01(ident, chall, otherKey)
+	test.AssertError(t, err, "Validated with another account's key")
+	test.AssertEquals(t, invalidChall.Error.Type, core.UnauthorizedProblem)
+
+	invalidChall, err = va.validateDNS01(core.AcmeIdentifier{Type: core.IdentifierIP, Value: "127.0.0.1"}, chall, AccountKey)
+	test.AssertError(t, err, "Validated an IP address through DNS")
+	test.AssertEquals(t, invalidChall.Error.Type, core.MalformedProblem)
+
+	va.DNSResolver = &mocks.MockDNS{}
+	invalidChall, err = va.validateDNS01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "servfail.com"}, chall, AccountKey)
+	test.AssertError(t, err, "Validated despite a DNS failure")
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+}
+
 // TestDNSValidationLive is an integration test, depending on
 // the existance of some Internet resources. Because of that,
 // it asserts nothing; it is intended for coverage.
@@ -816,15 +1216,36 @@ func (ra *MockRegistrationAuthority) NewCertificate(req core.CertificateRequest,
 	return core.Certificate{}, nil
 }
 
+func (ra *MockRegistrationAuthority) NewOrder(order core.Order, regID int64) (core.Order, error) {
+	return order, nil
+}
+
+func (ra *MockRegistrationAuthority) FinalizeOrder(order core.Order, req core.CertificateRequest, regID int64) (core.Order, error) {
+	return order, nil
+}
+
 func (ra *MockRegistrationAuthority) UpdateRegistration(reg core.Registration, updated core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
+func (ra *MockRegistrationAuthority) DeactivateAuthorization(authz core.Authorization) (core.Authorization, error) {
+	return authz, nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateRegistration(reg core.Registration) (core.Registration, error) {
+	return reg, nil
+}
+
+func (ra *MockRegistrationAuthority) ChangeRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (core.Registration, error) {
+	reg.Key = newKey
+	return reg, nil
+}
+
 func (ra *MockRegistrationAuthority) UpdateAuthorization(authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate) error {
+func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate, reasonCode int) error {
 	return nil
 }
 
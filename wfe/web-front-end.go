@@ -7,12 +7,17 @@ package wfe
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -24,6 +29,7 @@ import (
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/policy"
 )
 
 // Paths are the ACME-spec identified URL path-segments for various methods
@@ -35,12 +41,29 @@ const (
 	AuthzPath      = "/acme/authz/"
 	NewCertPath    = "/acme/new-cert"
 	CertPath       = "/acme/cert/"
+	NewOrderPath   = "/acme/new-order"
+	OrderPath      = "/acme/order/"
+	FinalizePath   = "/acme/finalize/"
 	RevokeCertPath = "/acme/revoke-cert"
+	KeyChangePath  = "/acme/key-change"
+	AuthzListPath  = "/acme/authz-list/"
+	CertListPath   = "/acme/cert-list/"
 	TermsPath      = "/terms"
 	IssuerPath     = "/acme/issuer-cert"
 	BuildIDPath    = "/build"
 )
 
+// subscriberRevocationReasons are the RFC 5280 reason codes a subscriber may
+// give when revoking a certificate. The remaining codes describe events only
+// the CA can attest to.
+var subscriberRevocationReasons = map[int]bool{
+	0: true, // unspecified
+	1: true, // keyCompromise
+	3: true, // affiliationChanged
+	4: true, // superseded
+	5: true, // cessationOfOperation
+}
+
 type WebFrontEndImpl struct {
 	RA    core.RegistrationAuthority
 	SA    core.StorageGetter
@@ -55,6 +78,12 @@ type WebFrontEndImpl struct {
 	AuthzBase string
 	NewCert   string
 	CertBase  string
+	NewOrder  string
+	OrderBase string
+
+	FinalizeBase  string
+	AuthzListBase string
+	CertListBase  string
 
 	// JSON encoded endpoint directory
 	DirectoryJSON []byte
@@ -62,9 +91,21 @@ type WebFrontEndImpl struct {
 	// Issuer certificate (DER) for /acme/issuer-cert
 	IssuerCert []byte
 
+	// Certificates (DER) of every intermediate the CA issues under. Each is
+	// served at /acme/issuer-cert/<id>, and is the issuer linked to and
+	// chained to the certificates it signed.
+	IssuerCerts [][]byte
+
 	// URL to the current subscriber agreement (should contain some version identifier)
 	SubscriberAgreementURL string
 
+	// Metadata advertised in the directory: the CA's website, the domains
+	// CAA records must name to allow issuance, and whether new registrations
+	// must be bound to an external account.
+	Website                 string
+	CAAIdentities           []string
+	ExternalAccountRequired bool
+
 	// Register of anti-replay nonces
 	nonceService core.NonceService
 
@@ -73,8 +114,15 @@ type WebFrontEndImpl struct {
 	CertNoCacheExpirationWindow time.Duration
 	IndexCacheDuration          time.Duration
 	IssuerCacheDuration         time.Duration
+
+	// CORS settings. An empty AllowOrigins permits any origin.
+	AllowOrigins []string
 }
 
+// statusTooManyRequests is the HTTP status for rate limited requests
+// (RFC 6585)
+const statusTooManyRequests = 429
+
 func statusCodeFromError(err interface{}) int {
 	// Populate these as needed.  We probably should trim the error list in util.go
 	switch err.(type) {
@@ -90,6 +138,8 @@ func statusCodeFromError(err interface{}) int {
 		return http.StatusNotFound
 	case core.SignatureValidationError:
 		return http.StatusPreconditionFailed
+	case core.RateLimitedError:
+		return statusTooManyRequests
 	case core.InternalServerError:
 		return http.StatusInternalServerError
 	default:
@@ -97,6 +147,15 @@ func statusCodeFromError(err interface{}) int {
 	}
 }
 
+// directoryMeta is the "meta" member of the directory, describing the CA
+// rather than its resources.
+type directoryMeta struct {
+	TermsOfService          string   `json:"terms-of-service,omitempty"`
+	Website                 string   `json:"website,omitempty"`
+	CAAIdentities           []string `json:"caa-identities,omitempty"`
+	ExternalAccountRequired bool     `json:"external-account-required,omitempty"`
+}
+
 type requestEvent struct {
 	ID           string         `json:",omitempty"`
 	RealIP       string         `json:",omitempty"`
@@ -161,7 +220,7 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h fun
 		if err == nil {
 			response.Header().Set("Replay-Nonce", nonce)
 		}
-		response.Header().Set("Access-Control-Allow-Origin", "*")
+		wfe.setCORSHeaders(response, request)
 
 		switch request.Method {
 		case "HEAD":
@@ -170,7 +229,12 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h fun
 			// sending a body.
 			response = BodylessResponseWriter{response}
 		case "OPTIONS":
-			// TODO, #469
+			// CORS preflight. Answer it here rather than in the handler, unless
+			// the handler has asked to see OPTIONS requests itself.
+			if !methodsOK["OPTIONS"] {
+				wfe.options(response, request, methods)
+				return
+			}
 		}
 
 		if _, ok := methodsOK[request.Method]; !ok {
@@ -187,6 +251,52 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h fun
 	})
 }
 
+// corsMaxAge is how long, in seconds, browsers may cache preflight results
+const corsMaxAge = 86400
+
+// setCORSHeaders permits cross-origin requests from the configured origins,
+// and exposes the response headers ACME clients need to read.
+func (wfe *WebFrontEndImpl) setCORSHeaders(response http.ResponseWriter, request *http.Request) {
+	allowOrigin := ""
+	if len(wfe.AllowOrigins) == 0 {
+		allowOrigin = "*"
+	} else {
+		origin := request.Header.Get("Origin")
+		for _, allowed := range wfe.AllowOrigins {
+			if allowed == "*" {
+				allowOrigin = "*"
+				break
+			}
+			if origin != "" && allowed == origin {
+				allowOrigin = origin
+			}
+		}
+		// The response depends on the origin unless every origin is allowed
+		if allowOrigin != "*" {
+			response.Header().Add("Vary", "Origin")
+		}
+	}
+	if allowOrigin == "" {
+		return
+	}
+	response.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+	response.Header().Set("Access-Control-Expose-Headers", "Link, Location, Replay-Nonce")
+}
+
+// options answers CORS preflight requests for a resource supporting the
+// given methods.
+func (wfe *WebFrontEndImpl) options(response http.ResponseWriter, request *http.Request, methods []string) {
+	allowed := strings.Join(methods, ", ")
+	response.Header().Set("Allow", allowed)
+	// Browsers only care about these if the origin was allowed
+	if response.Header().Get("Access-Control-Allow-Origin") != "" {
+		response.Header().Set("Access-Control-Allow-Methods", allowed)
+		response.Header().Set("Access-Control-Allow-Headers", "Content-Type, Link, Location, Replay-Nonce")
+		response.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+	}
+	response.WriteHeader(http.StatusOK)
+}
+
 // Handler returns an http.Handler that uses various functions for
 // various ACME-specified paths.
 func (wfe *WebFrontEndImpl) Handler() (http.Handler, error) {
@@ -196,13 +306,29 @@ func (wfe *WebFrontEndImpl) Handler() (http.Handler, error) {
 	wfe.AuthzBase = wfe.BaseURL + AuthzPath
 	wfe.NewCert = wfe.BaseURL + NewCertPath
 	wfe.CertBase = wfe.BaseURL + CertPath
+	wfe.NewOrder = wfe.BaseURL + NewOrderPath
+	wfe.OrderBase = wfe.BaseURL + OrderPath
+	wfe.FinalizeBase = wfe.BaseURL + FinalizePath
+	wfe.AuthzListBase = wfe.BaseURL + AuthzListPath
+	wfe.CertListBase = wfe.BaseURL + CertListPath
 
 	// Only generate directory once
-	directory := map[string]string{
+	directory := map[string]interface{}{
 		"new-reg":     wfe.NewReg,
 		"new-authz":   wfe.NewAuthz,
 		"new-cert":    wfe.NewCert,
+		"new-order":   wfe.NewOrder,
 		"revoke-cert": wfe.BaseURL + RevokeCertPath,
+		"key-change":  wfe.BaseURL + KeyChangePath,
+	}
+	meta := directoryMeta{
+		TermsOfService:          wfe.SubscriberAgreementURL,
+		Website:                 wfe.Website,
+		CAAIdentities:           wfe.CAAIdentities,
+		ExternalAccountRequired: wfe.ExternalAccountRequired,
+	}
+	if meta.TermsOfService != "" || meta.Website != "" || len(meta.CAAIdentities) > 0 || meta.ExternalAccountRequired {
+		directory["meta"] = meta
 	}
 	directoryJSON, err := json.Marshal(directory)
 	if err != nil {
@@ -219,9 +345,16 @@ func (wfe *WebFrontEndImpl) Handler() (http.Handler, error) {
 	wfe.HandleFunc(m, RegPath, wfe.Registration, "POST")
 	wfe.HandleFunc(m, AuthzPath, wfe.Authorization, "GET", "POST")
 	wfe.HandleFunc(m, CertPath, wfe.Certificate, "GET")
+	wfe.HandleFunc(m, NewOrderPath, wfe.CreateOrder, "POST")
+	wfe.HandleFunc(m, OrderPath, wfe.Order, "GET")
+	wfe.HandleFunc(m, FinalizePath, wfe.FinalizeOrder, "POST")
+	wfe.HandleFunc(m, AuthzListPath, wfe.AuthorizationList, "POST")
+	wfe.HandleFunc(m, CertListPath, wfe.CertificateList, "POST")
 	wfe.HandleFunc(m, RevokeCertPath, wfe.RevokeCertificate, "POST")
+	wfe.HandleFunc(m, KeyChangePath, wfe.KeyChange, "POST")
 	wfe.HandleFunc(m, TermsPath, wfe.Terms, "GET")
 	wfe.HandleFunc(m, IssuerPath, wfe.Issuer, "GET")
+	wfe.HandleFunc(m, IssuerPath+"/", wfe.Issuer, "GET")
 	wfe.HandleFunc(m, BuildIDPath, wfe.BuildID, "GET")
 	return m, nil
 }
@@ -274,10 +407,15 @@ func parseIDFromPath(path string) string {
 }
 
 const (
-	unknownKey   = "No registration exists matching provided key"
-	malformedJWS = "Unable to read/verify body"
+	unknownKey     = "No registration exists matching provided key"
+	malformedJWS   = "Unable to read/verify body"
+	deactivatedReg = "Registration has been deactivated"
 )
 
+// errDeactivatedReg is returned by verifyPOST when the request is signed by
+// the key of a deactivated registration.
+var errDeactivatedReg = errors.New(deactivatedReg)
+
 func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool, resource core.AcmeResource) ([]byte, *jose.JsonWebKey, core.Registration, error) {
 	var err error
 	var reg core.Registration
@@ -322,6 +460,10 @@ func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool, res
 		return nil, nil, reg, err
 	}
 	key := parsedJws.Signatures[0].Header.JsonWebKey
+	if err = core.CheckJWSAlgorithm(key, parsedJws.Signatures[0].Header.Algorithm); err != nil {
+		wfe.log.Debug(err.Error())
+		return nil, nil, reg, err
+	}
 	payload, header, err := parsedJws.Verify(key)
 	if err != nil {
 		puberr := core.SignatureValidationError("JWS verification error")
@@ -352,6 +494,10 @@ func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool, res
 		// Otherwise we just return an empty registration. The caller is expected
 		// to use the returned key instead.
 		reg = core.Registration{}
+	} else if reg.Status == core.StatusDeactivated {
+		// A deactivated registration keeps its key, but may not use it for
+		// anything further.
+		return nil, nil, reg, errDeactivatedReg
 	}
 
 	// Check that the "resource" field is present and has the correct value
@@ -393,6 +539,8 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, msg string,
 		fallthrough
 	case http.StatusBadRequest:
 		problem.Type = core.MalformedProblem
+	case statusTooManyRequests:
+		problem.Type = core.RateLimitedProblem
 	default: // Either http.StatusInternalServerError or an unexpected code
 		problem.Type = core.ServerInternalProblem
 	}
@@ -431,7 +579,12 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 	defer wfe.logRequestDetails(&logEvent)
 
 	body, key, _, err := wfe.verifyPOST(request, false, core.ResourceNewReg)
-	if err != nil {
+	if err == errDeactivatedReg {
+		// The key of a deactivated registration stays reserved
+		logEvent.Error = err.Error()
+		wfe.sendError(response, deactivatedReg, nil, http.StatusForbidden)
+		return
+	} else if err != nil {
 		logEvent.Error = err.Error()
 		wfe.sendError(response, malformedJWS, err, http.StatusBadRequest)
 		return
@@ -457,6 +610,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 		return
 	}
 	init.Key = *key
+	init.InitialIP = clientIP(request, logEvent)
 
 	reg, err := wfe.RA.NewRegistration(init)
 	if err != nil {
@@ -471,6 +625,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 	// that reg.ID is a string being passed to %d.
 	var id int64 = reg.ID
 	regURL := fmt.Sprintf("%s%d", wfe.RegBase, id)
+	wfe.addCollectionURLs(&reg)
 	responseBody, err := json.Marshal(reg)
 	if err != nil {
 		logEvent.Error = err.Error()
@@ -506,6 +661,9 @@ func (wfe *WebFrontEndImpl) NewAuthorization(response http.ResponseWriter, reque
 		if err == sql.ErrNoRows {
 			respMsg = unknownKey
 			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
 		}
 		wfe.sendError(response, respMsg, err, respCode)
 		return
@@ -570,7 +728,11 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 	// We don't ask verifyPOST to verify there is a correponding registration,
 	// because anyone with the right private key can revoke a certificate.
 	body, requestKey, registration, err := wfe.verifyPOST(request, false, core.ResourceRevokeCert)
-	if err != nil {
+	if err == errDeactivatedReg {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, deactivatedReg, nil, http.StatusForbidden)
+		return
+	} else if err != nil {
 		logEvent.Error = err.Error()
 		wfe.sendError(response, malformedJWS, err, http.StatusBadRequest)
 		return
@@ -580,6 +742,7 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 
 	type RevokeRequest struct {
 		CertificateDER core.JSONBuffer `json:"certificate"`
+		Reason         *int            `json:"reason"`
 	}
 	var revokeRequest RevokeRequest
 	if err = json.Unmarshal(body, &revokeRequest); err != nil {
@@ -596,6 +759,22 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 		return
 	}
 
+	reasonCode := 0
+	if revokeRequest.Reason != nil {
+		reasonCode = *revokeRequest.Reason
+		if _, ok := core.RevocationReasons[reasonCode]; !ok {
+			logEvent.Error = "Invalid revocation reason"
+			wfe.sendError(response, logEvent.Error, "", http.StatusBadRequest)
+			return
+		}
+		if !subscriberRevocationReasons[reasonCode] {
+			logEvent.Error = fmt.Sprintf("Revocation reason %s is not allowed for subscribers", core.RevocationReasons[reasonCode])
+			wfe.sendError(response, logEvent.Error, "", http.StatusBadRequest)
+			return
+		}
+	}
+	logEvent.Extra["RevocationReason"] = core.RevocationReasons[reasonCode]
+
 	serial := core.SerialToString(providedCert.SerialNumber)
 	logEvent.Extra["ProvidedCertificateSerial"] = serial
 	cert, err := wfe.SA.GetCertificate(serial)
@@ -629,10 +808,18 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 		return
 	}
 
-	// TODO: Implement method of revocation by authorizations on account.
-	if !(core.KeyDigestEquals(requestKey, parsedCertificate.PublicKey) ||
-		registration.ID == cert.RegistrationID) {
-		logEvent.Error = "Revocation request must be signed by private key of cert to be revoked"
+	// A certificate may be revoked by its own key, by the registration that
+	// requested it, or by any registration that currently holds valid
+	// authorizations for all of the names it contains.
+	var revokedBy string
+	if core.KeyDigestEquals(requestKey, parsedCertificate.PublicKey) {
+		revokedBy = "certificate key"
+	} else if registration.ID != 0 && registration.ID == cert.RegistrationID {
+		revokedBy = "issuing registration"
+	} else if wfe.authorizedForNames(registration, parsedCertificate) {
+		revokedBy = "authorized registration"
+	} else {
+		logEvent.Error = "Revocation request must be signed by private key of cert to be revoked, or by a registration authorized for all of its names"
 		wfe.log.Debug("Key mismatch for revoke")
 		wfe.sendError(response,
 			logEvent.Error,
@@ -640,8 +827,13 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 			http.StatusForbidden)
 		return
 	}
+	logEvent.Extra["RevocationAuthorizedBy"] = revokedBy
 
-	err = wfe.RA.RevokeCertificate(*parsedCertificate)
+	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+	var regID int64 = registration.ID
+	wfe.log.Audit(fmt.Sprintf("Revocation of %s (%s) requested by registration %d, authorized by %s", serial, core.RevocationReasons[reasonCode], regID, revokedBy))
+
+	err = wfe.RA.RevokeCertificate(*parsedCertificate, reasonCode)
 	if err != nil {
 		logEvent.Error = err.Error()
 		wfe.sendError(response, "Failed to revoke certificate", err, statusCodeFromError(err))
@@ -653,6 +845,30 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 	}
 }
 
+// authorizedForNames returns true if the registration holds a currently valid
+// authorization for every DNS name and IP address in the certificate.
+func (wfe *WebFrontEndImpl) authorizedForNames(registration core.Registration, cert *x509.Certificate) bool {
+	var identifiers []core.AcmeIdentifier
+	for _, name := range cert.DNSNames {
+		// Wildcard names are authorized through their base domain
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: policy.WildcardBase(name)})
+	}
+	for _, ip := range cert.IPAddresses {
+		identifiers = append(identifiers, core.AcmeIdentifier{Type: core.IdentifierIP, Value: ip.String()})
+	}
+	if registration.ID == 0 || len(identifiers) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, identifier := range identifiers {
+		authz, err := wfe.SA.GetLatestValidAuthorization(registration.ID, identifier)
+		if err != nil || authz.Expires == nil || authz.Expires.Before(now) {
+			return false
+		}
+	}
+	return true
+}
+
 func (wfe *WebFrontEndImpl) logCsr(remoteAddr string, cr core.CertificateRequest, registration core.Registration) {
 	var csrLog = struct {
 		RemoteAddr   string
@@ -680,6 +896,9 @@ func (wfe *WebFrontEndImpl) NewCertificate(response http.ResponseWriter, request
 		if err == sql.ErrNoRows {
 			respMsg = unknownKey
 			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
 		}
 		wfe.sendError(response, respMsg, err, respCode)
 		return
@@ -734,12 +953,13 @@ func (wfe *WebFrontEndImpl) NewCertificate(response http.ResponseWriter, request
 	serial := parsedCertificate.SerialNumber
 	certURL := fmt.Sprintf("%s%016x", wfe.CertBase, serial.Rsh(serial, 64))
 
-	// TODO Content negotiation
+	issuerDER, issuerPath := wfe.issuerOf(parsedCertificate)
+	contentType := negotiateCertificateType(request)
 	response.Header().Add("Location", certURL)
-	response.Header().Add("Link", link(wfe.BaseURL+IssuerPath, "up"))
-	response.Header().Set("Content-Type", "application/pkix-cert")
+	response.Header().Add("Link", link(wfe.BaseURL+issuerPath, "up"))
+	response.Header().Set("Content-Type", contentType)
 	response.WriteHeader(http.StatusCreated)
-	if _, err = response.Write(cert.DER); err != nil {
+	if _, err = response.Write(encodeCertificate(cert.DER, issuerDER, contentType)); err != nil {
 		logEvent.Error = err.Error()
 		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
 	}
@@ -747,6 +967,194 @@ func (wfe *WebFrontEndImpl) NewCertificate(response http.ResponseWriter, request
 	wfe.Stats.Inc("Certificates", 1, 1.0)
 }
 
+// CreateOrder is used by clients to submit a new order for a certificate
+// covering a set of identifiers.
+func (wfe *WebFrontEndImpl) CreateOrder(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	body, _, currReg, err := wfe.verifyPOST(request, true, core.ResourceNewOrder)
+	if err != nil {
+		logEvent.Error = err.Error()
+		respMsg := malformedJWS
+		respCode := http.StatusBadRequest
+		if err == sql.ErrNoRows {
+			respMsg = unknownKey
+			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
+		}
+		wfe.sendError(response, respMsg, err, respCode)
+		return
+	}
+	logEvent.Requester = currReg.ID
+	logEvent.Contacts = currReg.Contact
+	// Any version of the agreement is acceptable here. Version match is enforced in
+	// wfe.Registration when agreeing the first time. Agreement updates happen
+	// by mailing subscribers and don't require a registration update.
+	if currReg.Agreement == "" {
+		logEvent.Error = "Must agree to subscriber agreement before any further actions"
+		wfe.sendError(response, logEvent.Error, nil, http.StatusForbidden)
+		return
+	}
+
+	var init core.Order
+	if err = json.Unmarshal(body, &init); err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Error unmarshaling JSON", err, http.StatusBadRequest)
+		return
+	}
+	logEvent.Extra["Identifiers"] = init.Identifiers
+
+	order, err := wfe.RA.NewOrder(init, currReg.ID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Error creating new order", err, statusCodeFromError(err))
+		return
+	}
+	logEvent.Extra["OrderID"] = order.ID
+
+	orderURL := wfe.OrderBase + order.ID
+	wfe.prepOrderForDisplay(&order)
+	responseBody, err := json.Marshal(order)
+	if err != nil {
+		logEvent.Error = err.Error()
+		// StatusInternalServerError because we generated the order, it should be OK
+		wfe.sendError(response, "Error marshaling order", err, http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Add("Location", orderURL)
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusCreated)
+	if _, err = response.Write(responseBody); err != nil {
+		logEvent.Error = err.Error()
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+	wfe.Stats.Inc("Orders", 1, 1.0)
+}
+
+// Order is used by clients to poll the status of an order.
+func (wfe *WebFrontEndImpl) Order(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	id := parseIDFromPath(request.URL.Path)
+	order, err := wfe.SA.GetOrder(id)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to find order", err, http.StatusNotFound)
+		return
+	}
+	logEvent.Extra["OrderID"] = order.ID
+	logEvent.Extra["OrderRegistrationID"] = order.RegistrationID
+	logEvent.Extra["OrderStatus"] = order.Status
+
+	wfe.sendOrder(response, order, &logEvent)
+}
+
+// FinalizeOrder is used by clients to submit the CSR for an order whose
+// authorizations are all valid.
+func (wfe *WebFrontEndImpl) FinalizeOrder(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	body, _, reg, err := wfe.verifyPOST(request, true, core.ResourceFinalize)
+	if err != nil {
+		logEvent.Error = err.Error()
+		respMsg := malformedJWS
+		respCode := http.StatusBadRequest
+		if err == sql.ErrNoRows {
+			respMsg = unknownKey
+			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
+		}
+		wfe.sendError(response, respMsg, err, respCode)
+		return
+	}
+	logEvent.Requester = reg.ID
+	logEvent.Contacts = reg.Contact
+
+	id := parseIDFromPath(request.URL.Path)
+	order, err := wfe.SA.GetOrder(id)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to find order", err, http.StatusNotFound)
+		return
+	}
+	logEvent.Extra["OrderID"] = order.ID
+
+	if reg.ID != order.RegistrationID {
+		logEvent.Error = fmt.Sprintf("User: %v != Order: %v", reg.ID, order.RegistrationID)
+		wfe.sendError(response, "User registration ID doesn't match registration ID in order",
+			logEvent.Error,
+			http.StatusForbidden)
+		return
+	}
+
+	var init core.CertificateRequest
+	if err = json.Unmarshal(body, &init); err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Error unmarshaling certificate request", err, http.StatusBadRequest)
+		return
+	}
+	wfe.logCsr(request.RemoteAddr, init, reg)
+	logEvent.Extra["CSRDNSNames"] = init.CSR.DNSNames
+	logEvent.Extra["CSRIPAddresses"] = init.CSR.IPAddresses
+
+	order, err = wfe.RA.FinalizeOrder(order, init, reg.ID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Error finalizing order", err, statusCodeFromError(err))
+		return
+	}
+	logEvent.Extra["OrderStatus"] = order.Status
+
+	wfe.sendOrder(response, order, &logEvent)
+	if order.Status == core.StatusValid {
+		wfe.Stats.Inc("Certificates", 1, 1.0)
+	}
+}
+
+// prepOrderForDisplay replaces the internal references in an order with the
+// URLs a client follows, and blanks out the fields only the CA needs.
+func (wfe *WebFrontEndImpl) prepOrderForDisplay(order *core.Order) {
+	authzURLs := make([]string, len(order.Authorizations))
+	for i, id := range order.Authorizations {
+		authzURLs[i] = wfe.AuthzBase + id
+	}
+	order.Authorizations = authzURLs
+	order.Finalize = wfe.FinalizeBase + order.ID
+	if order.CertificateSerial != "" {
+		// Certificate URLs use only the sequential part of the serial
+		order.Certificate = wfe.CertBase + order.CertificateSerial[:16]
+	}
+
+	order.ID = ""
+	order.RegistrationID = 0
+	order.CertificateSerial = ""
+}
+
+func (wfe *WebFrontEndImpl) sendOrder(response http.ResponseWriter, order core.Order, logEvent *requestEvent) {
+	wfe.prepOrderForDisplay(&order)
+	jsonReply, err := json.Marshal(order)
+	if err != nil {
+		logEvent.Error = err.Error()
+		// InternalServerError because this is a failure to decode from our DB.
+		wfe.sendError(response, "Failed to marshal order", err, http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(jsonReply); err != nil {
+		logEvent.Error = err.Error()
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
 func (wfe *WebFrontEndImpl) challenge(authz core.Authorization, response http.ResponseWriter, request *http.Request, logEvent requestEvent) requestEvent {
 	// Check that the requested challenge exists within the authorization
 	found := false
@@ -799,6 +1207,9 @@ func (wfe *WebFrontEndImpl) challenge(authz core.Authorization, response http.Re
 			if err == sql.ErrNoRows {
 				respMsg = unknownKey
 				respCode = http.StatusForbidden
+			} else if err == errDeactivatedReg {
+				respMsg = deactivatedReg
+				respCode = http.StatusForbidden
 			}
 			wfe.sendError(response, respMsg, err, respCode)
 			return logEvent
@@ -878,6 +1289,9 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 		if err == sql.ErrNoRows {
 			respMsg = unknownKey
 			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
 		}
 		wfe.sendError(response, respMsg, err, respCode)
 		return
@@ -923,14 +1337,27 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 	// serialize the update as JSON to send via AMQP to the RA.
 	update.Key = currReg.Key
 
-	// Ask the RA to update this authorization.
-	updatedReg, err := wfe.RA.UpdateRegistration(currReg, update)
+	// The only status change a subscriber may ask for is deactivation, which
+	// ignores any other fields in the update.
+	var updatedReg core.Registration
+	switch update.Status {
+	case "", core.StatusValid:
+		// Ask the RA to update this registration.
+		updatedReg, err = wfe.RA.UpdateRegistration(currReg, update)
+	case core.StatusDeactivated:
+		updatedReg, err = wfe.RA.DeactivateRegistration(currReg)
+	default:
+		logEvent.Error = fmt.Sprintf("Invalid registration status [%s]", update.Status)
+		wfe.sendError(response, logEvent.Error, nil, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		logEvent.Error = err.Error()
 		wfe.sendError(response, "Unable to update registration", err, statusCodeFromError(err))
 		return
 	}
 
+	wfe.addCollectionURLs(&updatedReg)
 	jsonReply, err := json.Marshal(updatedReg)
 	if err != nil {
 		logEvent.Error = err.Error()
@@ -947,6 +1374,261 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 	response.Write(jsonReply)
 }
 
+// verifyKeyChange checks the inner JWS of a key-change request. It must be
+// signed by the new key, which it carries in its header, and its payload must
+// name the registration being changed and that registration's current key.
+func verifyKeyChange(newKeyJWS *jose.JsonWebSignature, regURL string, currKey jose.JsonWebKey) (*jose.JsonWebKey, error) {
+	if len(newKeyJWS.Signatures) > 1 {
+		return nil, core.SignatureValidationError("Too many signatures on new key JWS")
+	}
+	if len(newKeyJWS.Signatures) == 0 {
+		return nil, core.SignatureValidationError("New key JWS not signed")
+	}
+
+	newKey := newKeyJWS.Signatures[0].Header.JsonWebKey
+	if newKey == nil {
+		return nil, core.SignatureValidationError("New key JWS does not contain a key")
+	}
+	payload, _, err := newKeyJWS.Verify(newKey)
+	if err != nil {
+		return nil, core.SignatureValidationError("New key JWS verification error")
+	}
+
+	var keyChange struct {
+		Account string          `json:"account"`
+		OldKey  jose.JsonWebKey `json:"oldKey"`
+	}
+	if err = json.Unmarshal(payload, &keyChange); err != nil {
+		return nil, core.MalformedRequestError("New key JWS payload did not parse as JSON")
+	}
+	if keyChange.Account != regURL {
+		return nil, core.MalformedRequestError(fmt.Sprintf("New key JWS names the wrong account: %s != %s", keyChange.Account, regURL))
+	}
+	if !core.KeyDigestEquals(keyChange.OldKey, currKey) {
+		return nil, core.MalformedRequestError("New key JWS does not name the current account key")
+	}
+
+	return newKey, nil
+}
+
+// KeyChange is used by a client to replace the account key of its
+// registration. The request is signed by the current key and carries a second
+// JWS, signed by the new key, so that both keys attest to the change.
+func (wfe *WebFrontEndImpl) KeyChange(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	body, currKey, currReg, err := wfe.verifyPOST(request, true, core.ResourceKeyChange)
+	if err != nil {
+		logEvent.Error = err.Error()
+		respMsg := malformedJWS
+		respCode := http.StatusBadRequest
+		if err == sql.ErrNoRows {
+			respMsg = unknownKey
+			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
+		}
+		wfe.sendError(response, respMsg, err, respCode)
+		return
+	}
+	logEvent.Requester = currReg.ID
+	logEvent.Contacts = currReg.Contact
+
+	var keyChangeRequest struct {
+		NewKey *jose.JsonWebSignature `json:"newKey"`
+	}
+	if err = json.Unmarshal(body, &keyChangeRequest); err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Error unmarshaling key change request", err, http.StatusBadRequest)
+		return
+	}
+	if keyChangeRequest.NewKey == nil {
+		logEvent.Error = "Key change request does not contain a new key"
+		wfe.sendError(response, logEvent.Error, nil, http.StatusBadRequest)
+		return
+	}
+
+	// Use an explicitly typed variable. Otherwise `go vet' incorrectly complains
+	// that reg.ID is a string being passed to %d.
+	var id int64 = currReg.ID
+	regURL := fmt.Sprintf("%s%d", wfe.RegBase, id)
+	newKey, err := verifyKeyChange(keyChangeRequest.NewKey, regURL, *currKey)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to verify new key", err, statusCodeFromError(err))
+		return
+	}
+
+	if existingReg, err := wfe.SA.GetRegistrationByKey(*newKey); err == nil {
+		logEvent.Error = "New key is already in use"
+		response.Header().Set("Location", fmt.Sprintf("%s%d", wfe.RegBase, existingReg.ID))
+		wfe.sendError(response, logEvent.Error, nil, http.StatusConflict)
+		return
+	}
+
+	updatedReg, err := wfe.RA.ChangeRegistrationKey(currReg, *newKey)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to change registration key", err, statusCodeFromError(err))
+		return
+	}
+
+	wfe.addCollectionURLs(&updatedReg)
+	jsonReply, err := json.Marshal(updatedReg)
+	if err != nil {
+		logEvent.Error = err.Error()
+		// StatusInternalServerError because we just generated the reg, it should be OK
+		wfe.sendError(response, "Failed to marshal registration", err, http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Location", regURL)
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(jsonReply)
+}
+
+// addCollectionURLs fills in the URLs of the collections of authorizations
+// and certificates belonging to a registration.
+func (wfe *WebFrontEndImpl) addCollectionURLs(reg *core.Registration) {
+	// Use an explicitly typed variable. Otherwise `go vet' incorrectly complains
+	// that reg.ID is a string being passed to %d.
+	var id int64 = reg.ID
+	reg.Authorizations = fmt.Sprintf("%s%d", wfe.AuthzListBase, id)
+	reg.Certificates = fmt.Sprintf("%s%d", wfe.CertListBase, id)
+}
+
+// collectionPageSize is the number of entries in each page of a
+// registration's authorizations or certificates.
+const collectionPageSize = 100
+
+// verifyCollectionRequest checks a POST for one page of a registration's
+// collection. The request must be signed by the key of the registration named
+// in the path. If the request fails verification, an error has already been
+// sent to the client and ok is false.
+func (wfe *WebFrontEndImpl) verifyCollectionRequest(response http.ResponseWriter, request *http.Request, resource core.AcmeResource, logEvent *requestEvent) (reg core.Registration, page int, ok bool) {
+	_, _, reg, err := wfe.verifyPOST(request, true, resource)
+	if err != nil {
+		logEvent.Error = err.Error()
+		respMsg := malformedJWS
+		respCode := http.StatusBadRequest
+		if err == sql.ErrNoRows {
+			respMsg = unknownKey
+			respCode = http.StatusForbidden
+		} else if err == errDeactivatedReg {
+			respMsg = deactivatedReg
+			respCode = http.StatusForbidden
+		}
+		wfe.sendError(response, respMsg, err, respCode)
+		return
+	}
+	logEvent.Requester = reg.ID
+	logEvent.Contacts = reg.Contact
+
+	id, err := strconv.ParseInt(parseIDFromPath(request.URL.Path), 10, 64)
+	if err != nil || id != reg.ID {
+		logEvent.Error = "Request signing key did not match registration key"
+		wfe.sendError(response, logEvent.Error, "", http.StatusForbidden)
+		return
+	}
+
+	if pageStr := request.URL.Query().Get("page"); pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 0 {
+			logEvent.Error = "Page must be a non-negative integer"
+			wfe.sendError(response, logEvent.Error, pageStr, http.StatusBadRequest)
+			return
+		}
+	}
+	logEvent.Extra["Page"] = page
+	wfe.addCollectionURLs(&reg)
+	return reg, page, true
+}
+
+// sendCollection writes one page of a collection of URLs. If there are more
+// entries, a Link header points to the next page.
+func (wfe *WebFrontEndImpl) sendCollection(response http.ResponseWriter, name string, collectionURL string, page int, urls []string, more bool, logEvent *requestEvent) {
+	if urls == nil {
+		urls = []string{}
+	}
+	jsonReply, err := json.Marshal(map[string][]string{name: urls})
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Failed to marshal collection", err, http.StatusInternalServerError)
+		return
+	}
+
+	if more {
+		response.Header().Add("Link", link(fmt.Sprintf("%s?page=%d", collectionURL, page+1), "next"))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(jsonReply); err != nil {
+		logEvent.Error = err.Error()
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
+// AuthorizationList is used by a client to list the authorizations belonging
+// to its registration.
+func (wfe *WebFrontEndImpl) AuthorizationList(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	reg, page, ok := wfe.verifyCollectionRequest(response, request, core.ResourceAuthzList, &logEvent)
+	if !ok {
+		return
+	}
+
+	// Fetch one extra entry to find out whether there is a next page
+	authzs, err := wfe.SA.GetAuthorizationsByRegistration(reg.ID, page*collectionPageSize, collectionPageSize+1)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to list authorizations", err, http.StatusInternalServerError)
+		return
+	}
+
+	var urls []string
+	for i, authz := range authzs {
+		if i == collectionPageSize {
+			break
+		}
+		urls = append(urls, wfe.AuthzBase+authz.ID)
+	}
+	wfe.sendCollection(response, "authorizations", reg.Authorizations, page, urls, len(authzs) > collectionPageSize, &logEvent)
+}
+
+// CertificateList is used by a client to list the certificates issued to its
+// registration.
+func (wfe *WebFrontEndImpl) CertificateList(response http.ResponseWriter, request *http.Request) {
+	logEvent := wfe.populateRequestEvent(request)
+	defer wfe.logRequestDetails(&logEvent)
+
+	reg, page, ok := wfe.verifyCollectionRequest(response, request, core.ResourceCertList, &logEvent)
+	if !ok {
+		return
+	}
+
+	// Fetch one extra entry to find out whether there is a next page
+	certs, err := wfe.SA.GetCertificatesByRegistration(reg.ID, page*collectionPageSize, collectionPageSize+1)
+	if err != nil {
+		logEvent.Error = err.Error()
+		wfe.sendError(response, "Unable to list certificates", err, http.StatusInternalServerError)
+		return
+	}
+
+	var urls []string
+	for i, cert := range certs {
+		if i == collectionPageSize {
+			break
+		}
+		// Certificate URLs use only the sequential half of the serial number
+		urls = append(urls, wfe.CertBase+cert.Serial[:16])
+	}
+	wfe.sendCollection(response, "certificates", reg.Certificates, page, urls, len(certs) > collectionPageSize, &logEvent)
+}
+
 // Authorization is used by clients to submit an update to one of their
 // authorizations.
 func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request *http.Request) {
@@ -974,9 +1656,58 @@ func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request
 		return
 	}
 
-	// Blank out ID and regID
 	switch request.Method {
+	case "POST":
+		// The only update a subscriber may make to an authorization is to
+		// deactivate it.
+		body, _, currReg, err := wfe.verifyPOST(request, true, core.ResourceAuthz)
+		if err != nil {
+			logEvent.Error = err.Error()
+			respMsg := malformedJWS
+			respCode := http.StatusBadRequest
+			if err == sql.ErrNoRows {
+				respMsg = unknownKey
+				respCode = http.StatusForbidden
+			} else if err == errDeactivatedReg {
+				respMsg = deactivatedReg
+				respCode = http.StatusForbidden
+			}
+			wfe.sendError(response, respMsg, err, respCode)
+			return
+		}
+		logEvent.Requester = currReg.ID
+		logEvent.Contacts = currReg.Contact
+
+		if currReg.ID != authz.RegistrationID {
+			logEvent.Error = fmt.Sprintf("User: %v != Authorization: %v", currReg.ID, authz.RegistrationID)
+			wfe.sendError(response, "User registration ID doesn't match registration ID in authorization",
+				logEvent.Error,
+				http.StatusForbidden)
+			return
+		}
+
+		var update core.Authorization
+		if err = json.Unmarshal(body, &update); err != nil {
+			logEvent.Error = err.Error()
+			wfe.sendError(response, "Error unmarshaling authorization", err, http.StatusBadRequest)
+			return
+		}
+		if update.Status != core.StatusDeactivated {
+			logEvent.Error = fmt.Sprintf("Invalid authorization status [%s]", update.Status)
+			wfe.sendError(response, logEvent.Error, nil, http.StatusBadRequest)
+			return
+		}
+
+		authz, err = wfe.RA.DeactivateAuthorization(authz)
+		if err != nil {
+			logEvent.Error = err.Error()
+			wfe.sendError(response, "Unable to deactivate authorization", err, statusCodeFromError(err))
+			return
+		}
+		fallthrough
+
 	case "GET":
+		// Blank out ID and regID
 		authz.ID = ""
 		authz.RegistrationID = 0
 
@@ -999,6 +1730,62 @@ func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request
 
 var allHex = regexp.MustCompile("^[0-9a-f]+$")
 
+// Content types in which certificates can be served
+const (
+	derCertContentType  = "application/pkix-cert"
+	pemChainContentType = "application/pem-certificate-chain"
+	pemFileContentType  = "application/x-pem-file"
+)
+
+// negotiateCertificateType picks the certificate encoding that best matches
+// the request's Accept header. DER is used when nothing better matches, so
+// that clients which don't send Accept keep working.
+func negotiateCertificateType(request *http.Request) string {
+	best := derCertContentType
+	bestQ := -1.0
+	for _, accepted := range strings.Split(request.Header.Get("Accept"), ",") {
+		params := strings.Split(accepted, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		switch mediaType {
+		case derCertContentType, pemChainContentType, pemFileContentType:
+		default:
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 && q > bestQ {
+			best = mediaType
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// encodeCertificate renders a DER certificate in the given content type. For
+// application/pem-certificate-chain the issuer, if any, follows the leaf.
+func encodeCertificate(der, issuerDER []byte, contentType string) []byte {
+	switch contentType {
+	case pemChainContentType:
+		chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if len(issuerDER) > 0 {
+			chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuerDER})...)
+		}
+		return chain
+	case pemFileContentType:
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	default:
+		return der
+	}
+}
+
 // Certificate is used by clients to request a copy of their current certificate, or to
 // request a reissuance of the certificate.
 func (wfe *WebFrontEndImpl) Certificate(response http.ResponseWriter, request *http.Request) {
@@ -1038,11 +1825,16 @@ func (wfe *WebFrontEndImpl) Certificate(response http.ResponseWriter, request *h
 
 	addCacheHeader(response, wfe.CertCacheDuration.Seconds())
 
-	// TODO Content negotiation
-	response.Header().Set("Content-Type", "application/pkix-cert")
-	response.Header().Add("Link", link(IssuerPath, "up"))
+	issuerDER, issuerPath := wfe.IssuerCert, IssuerPath
+	if parsedCertificate, err := x509.ParseCertificate(cert.DER); err == nil {
+		issuerDER, issuerPath = wfe.issuerOf(parsedCertificate)
+	}
+	contentType := negotiateCertificateType(request)
+	response.Header().Set("Content-Type", contentType)
+	response.Header().Set("Vary", "Accept")
+	response.Header().Add("Link", link(issuerPath, "up"))
 	response.WriteHeader(http.StatusOK)
-	if _, err = response.Write(cert.DER); err != nil {
+	if _, err = response.Write(encodeCertificate(cert.DER, issuerDER, contentType)); err != nil {
 		logEvent.Error = err.Error()
 		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
 	}
@@ -1058,17 +1850,61 @@ func (wfe *WebFrontEndImpl) Terms(response http.ResponseWriter, request *http.Re
 	http.Redirect(response, request, wfe.SubscriberAgreementURL, http.StatusFound)
 }
 
-// Issuer obtains the issuer certificate used by this instance of Boulder.
+// issuerID identifies an issuer certificate in its /acme/issuer-cert URL,
+// by the first eight bytes of the SHA-256 digest of its DER encoding.
+func issuerID(der []byte) string {
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:8])
+}
+
+// issuerOf returns the issuer certificate that signed a certificate, and the
+// path it is served at. If it is not one of IssuerCerts, the default
+// IssuerCert is returned.
+func (wfe *WebFrontEndImpl) issuerOf(cert *x509.Certificate) ([]byte, string) {
+	for _, issuerDER := range wfe.IssuerCerts {
+		issuer, err := x509.ParseCertificate(issuerDER)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil {
+			return issuerDER, IssuerPath + "/" + issuerID(issuerDER)
+		}
+	}
+	return wfe.IssuerCert, IssuerPath
+}
+
+// Issuer obtains an issuer certificate used by this instance of Boulder:
+// the default one, or the one named by an ID following the issuer path.
 func (wfe *WebFrontEndImpl) Issuer(response http.ResponseWriter, request *http.Request) {
 	logEvent := wfe.populateRequestEvent(request)
 	defer wfe.logRequestDetails(&logEvent)
 
+	issuerDER := wfe.IssuerCert
+	if request.URL != nil && strings.HasPrefix(request.URL.Path, IssuerPath+"/") {
+		id := request.URL.Path[len(IssuerPath)+1:]
+		issuerDER = nil
+		for _, der := range wfe.IssuerCerts {
+			if issuerID(der) == id {
+				issuerDER = der
+				break
+			}
+		}
+		if issuerDER == nil {
+			logEvent.Error = "Issuer certificate not found"
+			addNoCacheHeader(response)
+			wfe.sendError(response, logEvent.Error, id, http.StatusNotFound)
+			return
+		}
+	}
+
 	addCacheHeader(response, wfe.IssuerCacheDuration.Seconds())
 
-	// TODO Content negotiation
-	response.Header().Set("Content-Type", "application/pkix-cert")
+	contentType := negotiateCertificateType(request)
+	response.Header().Set("Content-Type", contentType)
+	response.Header().Set("Vary", "Accept")
 	response.WriteHeader(http.StatusOK)
-	if _, err := response.Write(wfe.IssuerCert); err != nil {
+	// The issuer is the top of the chain we serve, so there is nothing to append
+	if _, err := response.Write(encodeCertificate(issuerDER, nil, contentType)); err != nil {
 		logEvent.Error = err.Error()
 		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
 	}
@@ -1099,6 +1935,19 @@ func (wfe *WebFrontEndImpl) logRequestDetails(logEvent *requestEvent) {
 	wfe.log.InfoObject(msg, logEvent)
 }
 
+// clientIP returns the address a request came from: the RealIP set by the
+// proxy in front of the WFE, or the address of the connection without one.
+func clientIP(request *http.Request, logEvent requestEvent) net.IP {
+	if ip := net.ParseIP(logEvent.RealIP); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
 func (wfe *WebFrontEndImpl) populateRequestEvent(request *http.Request) (logEvent requestEvent) {
 	logEvent = requestEvent{
 		ID:           core.NewToken(),
@@ -7,8 +7,12 @@ package wfe
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
@@ -18,6 +22,8 @@ import (
 	"io"
 	"io/ioutil"
 	"log/syslog"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -177,6 +183,13 @@ func (sa *MockSA) GetAuthorization(id string) (core.Authorization, error) {
 	return core.Authorization{}, nil
 }
 
+func (sa *MockSA) GetAuthorizationsByIdentifier(regID int64, identifier core.AcmeIdentifier, validUntil time.Time) ([]core.Authorization, error) {
+	if authz, err := sa.GetLatestValidAuthorization(regID, identifier); err == nil {
+		return []core.Authorization{authz}, nil
+	}
+	return []core.Authorization{}, nil
+}
+
 func (sa *MockSA) GetLatestValidAuthorization(registrationId int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
 	if registrationId == 1 && identifier.Type == "dns" {
 		if sa.authorizedDomains[identifier.Value] || identifier.Value == "not-an-example.com" {
@@ -187,6 +200,22 @@ func (sa *MockSA) GetLatestValidAuthorization(registrationId int64, identifier c
 	return core.Authorization{}, errors.New("no authz")
 }
 
+func (sa *MockSA) GetAuthorizationsByRegistration(regID int64, offset, limit int) ([]core.Authorization, error) {
+	if regID == 1 && offset == 0 {
+		return []core.Authorization{{ID: "valid", RegistrationID: 1}}, nil
+	}
+	return []core.Authorization{}, nil
+}
+
+func (sa *MockSA) GetCertificatesByRegistration(regID int64, offset, limit int) ([]core.Certificate, error) {
+	if regID == 1 && offset == 0 {
+		cert, err := sa.GetCertificate("000000000000000000000000000000ee")
+		cert.Serial = "000000000000000000000000000000ee"
+		return []core.Certificate{cert}, err
+	}
+	return []core.Certificate{}, nil
+}
+
 func (sa *MockSA) GetCertificate(serial string) (core.Certificate, error) {
 	// Serial ee == 238.crt
 	if serial == "000000000000000000000000000000ee" {
@@ -230,6 +259,26 @@ func (sa *MockSA) AlreadyDeniedCSR([]string) (bool, error) {
 	return false, nil
 }
 
+func (sa *MockSA) CountCertificatesByNames(domains []string, earliest, latest time.Time) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (sa *MockSA) CountFQDNSets(window time.Duration, names []string) (int64, error) {
+	return 0, nil
+}
+
+func (sa *MockSA) CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (int, error) {
+	return 0, nil
+}
+
+func (sa *MockSA) CountPendingAuthorizations(regID int64) (int, error) {
+	return 0, nil
+}
+
+func (sa *MockSA) CountInvalidAuthorizations(regID int64, identifier core.AcmeIdentifier, earliest, latest time.Time) (int, error) {
+	return 0, nil
+}
+
 func (sa *MockSA) AddCertificate(certDER []byte, regID int64) (digest string, err error) {
 	return
 }
@@ -261,10 +310,51 @@ func (sa *MockSA) UpdatePendingAuthorization(authz core.Authorization) (err erro
 	return
 }
 
+func (sa *MockSA) UpdatePendingChallenge(id string, index int, challenge core.Challenge) (authz core.Authorization, err error) {
+	return
+}
+
 func (sa *MockSA) UpdateRegistration(reg core.Registration) (err error) {
 	return
 }
 
+func (sa *MockSA) DeactivateAuthorization(id string) (err error) {
+	return
+}
+
+func (sa *MockSA) GetOrder(id string) (core.Order, error) {
+	if id == "ready" {
+		return core.Order{
+			ID:             id,
+			RegistrationID: 1,
+			Status:         core.StatusReady,
+			Identifiers:    []core.AcmeIdentifier{{Type: core.IdentifierDNS, Value: "not-an-example.com"}},
+			Authorizations: []string{"valid"},
+		}, nil
+	}
+	return core.Order{}, core.NotFoundError("No order")
+}
+
+func (sa *MockSA) GetPendingOrders(regID int64) ([]core.Order, error) {
+	return []core.Order{}, nil
+}
+
+func (sa *MockSA) NewOrder(order core.Order) (output core.Order, err error) {
+	return
+}
+
+func (sa *MockSA) UpdateOrder(order core.Order, status core.AcmeStatus) (err error) {
+	return
+}
+
+func (sa *MockSA) DeactivateRegistration(id int64) (err error) {
+	return
+}
+
+func (sa *MockSA) UpdateRegistrationKey(id int64, key jose.JsonWebKey) (err error) {
+	return
+}
+
 type MockRegistrationAuthority struct{}
 
 func (ra *MockRegistrationAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
@@ -281,15 +371,44 @@ func (ra *MockRegistrationAuthority) NewCertificate(req core.CertificateRequest,
 	return core.Certificate{}, nil
 }
 
+func (ra *MockRegistrationAuthority) NewOrder(order core.Order, regID int64) (core.Order, error) {
+	order.ID = "ready"
+	order.RegistrationID = regID
+	order.Status = core.StatusPending
+	order.Authorizations = []string{"bkrPh2u0JUf18-rVBZtOOWWb3GuIiliypL-hBM9Ak1Q"}
+	return order, nil
+}
+
+func (ra *MockRegistrationAuthority) FinalizeOrder(order core.Order, req core.CertificateRequest, regID int64) (core.Order, error) {
+	order.Status = core.StatusValid
+	order.CertificateSerial = "000000000000000000000000000000ee"
+	return order, nil
+}
+
 func (ra *MockRegistrationAuthority) UpdateRegistration(reg core.Registration, updated core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
+func (ra *MockRegistrationAuthority) DeactivateAuthorization(authz core.Authorization) (core.Authorization, error) {
+	authz.Status = core.StatusDeactivated
+	return authz, nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateRegistration(reg core.Registration) (core.Registration, error) {
+	reg.Status = core.StatusDeactivated
+	return reg, nil
+}
+
+func (ra *MockRegistrationAuthority) ChangeRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (core.Registration, error) {
+	reg.Key = newKey
+	return reg, nil
+}
+
 func (ra *MockRegistrationAuthority) UpdateAuthorization(authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate) error {
+func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate, reasonCode int) error {
 	return nil
 }
 
@@ -343,6 +462,8 @@ func setupWFE(t *testing.T) WebFrontEndImpl {
 	wfe.AuthzBase = wfe.BaseURL + AuthzPath
 	wfe.NewCert = wfe.BaseURL + NewCertPath
 	wfe.CertBase = wfe.BaseURL + CertPath
+	wfe.AuthzListBase = wfe.BaseURL + AuthzListPath
+	wfe.CertListBase = wfe.BaseURL + CertListPath
 	wfe.SubscriberAgreementURL = agreementURL
 	wfe.log.SyslogWriter = mocks.NewSyslogWriter()
 
@@ -391,7 +512,6 @@ func TestHandleFunc(t *testing.T) {
 		{[]string{"GET", "POST"}, "POST", true},
 		{[]string{"GET"}, "", false},
 		{[]string{"GET"}, "POST", false},
-		{[]string{"GET"}, "OPTIONS", false},     // TODO, #469
 		{[]string{"GET"}, "MAKE-COFFEE", false}, // 405, or 418?
 	} {
 		runWrappedHandler(&http.Request{Method: c.reqMethod}, c.allowed...)
@@ -421,6 +541,40 @@ func TestHandleFunc(t *testing.T) {
 	test.AssertEquals(t, stubCalled, false)
 	test.AssertEquals(t, rw.Body.String(), "")
 	test.AssertEquals(t, sortHeader(rw.Header().Get("Allow")), "GET, POST")
+
+	// CORS preflight is answered without calling the handler
+	runWrappedHandler(&http.Request{Method: "OPTIONS"}, "GET", "POST")
+	test.AssertEquals(t, stubCalled, false)
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Body.String(), "")
+	test.AssertEquals(t, sortHeader(rw.Header().Get("Allow")), "GET, POST")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "*")
+	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Allow-Methods")), "GET, POST")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Headers"), "Content-Type, Link, Location, Replay-Nonce")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Expose-Headers"), "Link, Location, Replay-Nonce")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Max-Age"), "86400")
+
+	// ... unless the handler wants OPTIONS itself
+	runWrappedHandler(&http.Request{Method: "OPTIONS"}, "GET", "OPTIONS")
+	test.AssertEquals(t, stubCalled, true)
+
+	// Configured origins are echoed back, others get no CORS headers
+	wfe.AllowOrigins = []string{"https://dashboard.example.com"}
+	runWrappedHandler(&http.Request{Method: "OPTIONS", Header: http.Header{"Origin": {"https://dashboard.example.com"}}}, "POST")
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "https://dashboard.example.com")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Methods"), "POST")
+	test.AssertEquals(t, rw.Header().Get("Vary"), "Origin")
+
+	runWrappedHandler(&http.Request{Method: "OPTIONS", Header: http.Header{"Origin": {"https://evil.example.com"}}}, "POST")
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Methods"), "")
+	test.AssertEquals(t, rw.Header().Get("Allow"), "POST")
+
+	runWrappedHandler(&http.Request{Method: "POST", Header: http.Header{"Origin": {"https://evil.example.com"}}}, "POST")
+	test.AssertEquals(t, stubCalled, true)
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "")
 }
 
 func TestStandardHeaders(t *testing.T) {
@@ -500,7 +654,47 @@ func TestDirectory(t *testing.T) {
 		URL:    url,
 	})
 	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
-	test.AssertEquals(t, responseWriter.Body.String(), `{"new-authz":"http://localhost:4300/acme/new-authz","new-cert":"http://localhost:4300/acme/new-cert","new-reg":"http://localhost:4300/acme/new-reg","revoke-cert":"http://localhost:4300/acme/revoke-cert"}`)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"key-change":"http://localhost:4300/acme/key-change","meta":{"terms-of-service":"http://example.invalid/terms"},"new-authz":"http://localhost:4300/acme/new-authz","new-cert":"http://localhost:4300/acme/new-cert","new-order":"http://localhost:4300/acme/new-order","new-reg":"http://localhost:4300/acme/new-reg","revoke-cert":"http://localhost:4300/acme/revoke-cert"}`)
+}
+
+func TestSendErrorRateLimited(t *testing.T) {
+	wfe := setupWFE(t)
+	responseWriter := httptest.NewRecorder()
+
+	err := core.RateLimitedError("Too many certificates already issued for: letsencrypt.org")
+	wfe.sendError(responseWriter, "Error creating new cert", err, statusCodeFromError(err))
+	test.AssertEquals(t, responseWriter.Code, 429)
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:rateLimited","detail":"Error creating new cert :: Too many certificates already issued for: letsencrypt.org"}`)
+}
+
+func TestDirectoryMeta(t *testing.T) {
+	wfe := setupWFE(t)
+	wfe.BaseURL = "http://localhost:4300"
+	wfe.SubscriberAgreementURL = agreementURL
+	wfe.Website = "https://letsencrypt.org"
+	wfe.CAAIdentities = []string{"letsencrypt.org"}
+	wfe.ExternalAccountRequired = true
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(DirectoryPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	var directory struct {
+		Meta directoryMeta
+	}
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &directory)
+	test.AssertNotError(t, err, "Couldn't unmarshal directory")
+	test.AssertEquals(t, directory.Meta.TermsOfService, agreementURL)
+	test.AssertEquals(t, directory.Meta.Website, "https://letsencrypt.org")
+	test.AssertEquals(t, len(directory.Meta.CAAIdentities), 1)
+	test.AssertEquals(t, directory.Meta.CAAIdentities[0], "letsencrypt.org")
+	test.Assert(t, directory.Meta.ExternalAccountRequired, "External account should be required")
 }
 
 // TODO: Write additional test cases for:
@@ -713,6 +907,42 @@ func TestChallenge(t *testing.T) {
 		`{"type":"dns","uri":"/acme/authz/asdf?challenge=foo"}`)
 }
 
+func TestVerifyPOSTECDSA(t *testing.T) {
+	wfe := setupWFE(t)
+	wfe.SA = &MockSA{}
+
+	testCases := []struct {
+		curve elliptic.Curve
+		alg   jose.SignatureAlgorithm
+		valid bool
+	}{
+		{elliptic.P256(), jose.ES256, true},
+		{elliptic.P384(), jose.ES384, true},
+		{elliptic.P521(), jose.ES512, false},
+	}
+	for _, tc := range testCases {
+		key, err := ecdsa.GenerateKey(tc.curve, rand.Reader)
+		test.AssertNotError(t, err, "Failed to generate key")
+		signer, err := jose.NewSigner(tc.alg, key)
+		test.AssertNotError(t, err, "Failed to make signer")
+		nonce, err := wfe.nonceService.Nonce()
+		test.AssertNotError(t, err, "Unable to create nonce")
+		result, err := signer.Sign([]byte(`{"resource":"new-reg"}`), nonce)
+		test.AssertNotError(t, err, "Failed to sign request")
+
+		_, jwk, _, err := wfe.verifyPOST(&http.Request{
+			Method: "POST",
+			Body:   makeBody(result.FullSerialize()),
+		}, false, core.ResourceNewReg)
+		if tc.valid {
+			test.AssertNotError(t, err, fmt.Sprintf("Rejected request signed with %s", tc.alg))
+			test.AssertEquals(t, core.KeyDigestEquals(jwk, &key.PublicKey), true)
+		} else {
+			test.AssertError(t, err, fmt.Sprintf("Accepted request signed with %s", tc.alg))
+		}
+	}
+}
+
 func TestNewRegistration(t *testing.T) {
 	wfe := setupWFE(t)
 	mux, err := wfe.Handler()
@@ -813,7 +1043,7 @@ func TestNewRegistration(t *testing.T) {
 		Body:   makeBody(result.FullSerialize()),
 	})
 
-	test.AssertEquals(t, responseWriter.Body.String(), `{"id":0,"key":{"kty":"RSA","n":"qnARLrT7Xz4gRcKyLdydmCr-ey9OuPImX4X40thk3on26FkMznR3fRjs66eLK7mmPcBZ6uOJseURU6wAaZNmemoYx1dMvqvWWIyiQleHSD7Q8vBrhR6uIoO4jAzJZR-ChzZuSDt7iHN-3xUVspu5XGwXU_MVJZshTwp4TaFx5elHIT_ObnTvTOU3Xhish07AbgZKmWsVbXh5s-CrIicU4OexJPgunWZ_YJJueOKmTvnLlTV4MzKR2oZlBKZ27S0-SfdV_QDx_ydle5oMAyKVtlAV35cyPMIsYNwgUGBCdY_2Uzi5eX0lTc7MPRwz6qR1kip-i59VcGcUQgqHV6Fyqw","e":"AQAB"},"contact":["tel:123456789"],"agreement":"http://example.invalid/terms"}`)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"id":0,"key":{"kty":"RSA","n":"qnARLrT7Xz4gRcKyLdydmCr-ey9OuPImX4X40thk3on26FkMznR3fRjs66eLK7mmPcBZ6uOJseURU6wAaZNmemoYx1dMvqvWWIyiQleHSD7Q8vBrhR6uIoO4jAzJZR-ChzZuSDt7iHN-3xUVspu5XGwXU_MVJZshTwp4TaFx5elHIT_ObnTvTOU3Xhish07AbgZKmWsVbXh5s-CrIicU4OexJPgunWZ_YJJueOKmTvnLlTV4MzKR2oZlBKZ27S0-SfdV_QDx_ydle5oMAyKVtlAV35cyPMIsYNwgUGBCdY_2Uzi5eX0lTc7MPRwz6qR1kip-i59VcGcUQgqHV6Fyqw","e":"AQAB"},"contact":["tel:123456789"],"agreement":"http://example.invalid/terms","authorizations":"/acme/authz-list/0","certificates":"/acme/cert-list/0"}`)
 	var reg core.Registration
 	err = json.Unmarshal([]byte(responseWriter.Body.String()), &reg)
 	test.AssertNotError(t, err, "Couldn't unmarshal returned registration object")
@@ -969,6 +1199,157 @@ func TestRevokeCertificateAlreadyRevoked(t *testing.T) {
 		`{"type":"urn:acme:error:malformed","detail":"Certificate already revoked"}`)
 }
 
+func TestRevokeCertificateReason(t *testing.T) {
+	keyPemBytes, err := ioutil.ReadFile("test/238.key")
+	test.AssertNotError(t, err, "Failed to load key")
+	key, err := jose.LoadPrivateKey(keyPemBytes)
+	test.AssertNotError(t, err, "Failed to load key")
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	test.Assert(t, ok, "Couldn't load RSA key")
+	signer, err := jose.NewSigner("RS256", rsaKey)
+	test.AssertNotError(t, err, "Failed to make signer")
+
+	certPemBytes, err := ioutil.ReadFile("test/238.crt")
+	test.AssertNotError(t, err, "Failed to load cert")
+	certBlock, _ := pem.Decode(certPemBytes)
+	test.Assert(t, certBlock != nil, "Failed to decode PEM")
+
+	wfe := setupWFE(t)
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+
+	revoke := func(reason int) *httptest.ResponseRecorder {
+		revokeRequestJSON, err := json.Marshal(struct {
+			Resource       string          `json:"resource"`
+			CertificateDER core.JSONBuffer `json:"certificate"`
+			Reason         int             `json:"reason"`
+		}{
+			Resource:       "revoke-cert",
+			CertificateDER: certBlock.Bytes,
+			Reason:         reason,
+		})
+		test.AssertNotError(t, err, "Failed to marshal request")
+		nonce, err := wfe.nonceService.Nonce()
+		test.AssertNotError(t, err, "Unable to create nonce")
+		result, _ := signer.Sign(revokeRequestJSON, nonce)
+		responseWriter := httptest.NewRecorder()
+		wfe.RevokeCertificate(responseWriter, &http.Request{
+			Method: "POST",
+			Body:   makeBody(result.FullSerialize()),
+		})
+		return responseWriter
+	}
+
+	// keyCompromise is a subscriber reason
+	responseWriter := revoke(1)
+	test.AssertEquals(t, responseWriter.Code, 200)
+
+	// cACompromise is not
+	responseWriter = revoke(2)
+	test.AssertEquals(t, responseWriter.Code, 400)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Revocation reason cACompromise is not allowed for subscribers"}`)
+
+	// 7 is not a reason at all
+	responseWriter = revoke(7)
+	test.AssertEquals(t, responseWriter.Code, 400)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Invalid revocation reason"}`)
+}
+
+// otherRegCertSA serves a certificate for not-an-example.com that was issued to
+// a registration other than the one making the revocation request.
+type otherRegCertSA struct {
+	MockSA
+	der []byte
+}
+
+func (sa *otherRegCertSA) GetCertificate(serial string) (core.Certificate, error) {
+	if serial == "000000000000000000000000000004d2" {
+		return core.Certificate{RegistrationID: 5, DER: sa.der}, nil
+	}
+	return sa.MockSA.GetCertificate(serial)
+}
+
+func (sa *otherRegCertSA) GetCertificateStatus(serial string) (core.CertificateStatus, error) {
+	if serial == "000000000000000000000000000004d2" {
+		return core.CertificateStatus{Status: core.OCSPStatusGood}, nil
+	}
+	return sa.MockSA.GetCertificateStatus(serial)
+}
+
+func makeRevocationRequest(t *testing.T, names []string) (*otherRegCertSA, []byte) {
+	keyPemBytes, err := ioutil.ReadFile("test/238.key")
+	test.AssertNotError(t, err, "Failed to load key")
+	key, err := jose.LoadPrivateKey(keyPemBytes)
+	test.AssertNotError(t, err, "Failed to load key")
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	test.Assert(t, ok, "Couldn't load RSA key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(0, 3, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &rsaKey.PublicKey, rsaKey)
+	test.AssertNotError(t, err, "Failed to create certificate")
+
+	revokeRequestJSON, err := json.Marshal(struct {
+		Resource       string          `json:"resource"`
+		CertificateDER core.JSONBuffer `json:"certificate"`
+	}{
+		Resource:       "revoke-cert",
+		CertificateDER: der,
+	})
+	test.AssertNotError(t, err, "Failed to marshal request")
+	return &otherRegCertSA{der: der}, revokeRequestJSON
+}
+
+// Revocation by a registration that did not request the certificate, but
+// holds valid authorizations for its names
+func TestRevokeCertificateWithAuthorizations(t *testing.T) {
+	test1JWK, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	test1Key, ok := test1JWK.(*rsa.PrivateKey)
+	test.Assert(t, ok, "Couldn't load RSA key")
+	accountKeySigner, err := jose.NewSigner("RS256", test1Key)
+	test.AssertNotError(t, err, "Failed to make signer")
+
+	wfe := setupWFE(t)
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+
+	// Registration 1 is authorized for not-an-example.com
+	sa, revokeRequestJSON := makeRevocationRequest(t, []string{"not-an-example.com"})
+	wfe.SA = sa
+	responseWriter := httptest.NewRecorder()
+	nonce, err := wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Unable to create nonce")
+	result, _ := accountKeySigner.Sign(revokeRequestJSON, nonce)
+	wfe.RevokeCertificate(responseWriter, &http.Request{
+		Method: "POST",
+		Body:   makeBody(result.FullSerialize()),
+	})
+	test.AssertEquals(t, responseWriter.Code, 200)
+	test.AssertEquals(t, responseWriter.Body.String(), "")
+
+	// ... but not for unauthorized.example.com
+	sa, revokeRequestJSON = makeRevocationRequest(t, []string{"not-an-example.com", "unauthorized.example.com"})
+	wfe.SA = sa
+	responseWriter = httptest.NewRecorder()
+	nonce, err = wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Unable to create nonce")
+	result, _ = accountKeySigner.Sign(revokeRequestJSON, nonce)
+	wfe.RevokeCertificate(responseWriter, &http.Request{
+		Method: "POST",
+		Body:   makeBody(result.FullSerialize()),
+	})
+	test.AssertEquals(t, responseWriter.Code, 403)
+	test.AssertContains(t, responseWriter.Body.String(), "urn:acme:error:unauthorized")
+}
+
 func TestAuthorization(t *testing.T) {
 	wfe := setupWFE(t)
 	mux, err := wfe.Handler()
@@ -1064,6 +1445,105 @@ func contains(s []string, e string) bool {
 	return false
 }
 
+func TestDeactivateAuthorization(t *testing.T) {
+	wfe := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(AuthzPath + "valid"),
+		Body:   makeBody(signRequest(t, `{"resource":"authz","status":"valid"}`, &wfe.nonceService)),
+	})
+	test.AssertEquals(t, responseWriter.Code, 400)
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Invalid authorization status [valid]"}`)
+
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(AuthzPath + "valid"),
+		Body:   makeBody(signRequest(t, `{"resource":"authz","status":"deactivated"}`, &wfe.nonceService)),
+	})
+	test.AssertEquals(t, responseWriter.Code, 200)
+	var authz core.Authorization
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &authz)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned authorization object")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	test.AssertEquals(t, authz.Identifier.Value, "not-an-example.com")
+}
+
+func TestOrders(t *testing.T) {
+	wfe := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+
+	// New orders are created with an authorization for each identifier
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(NewOrderPath),
+		Body: makeBody(signRequest(t, `{"resource":"new-order","identifiers":[{"type":"dns","value":"not-an-example.com"}]}`,
+			&wfe.nonceService)),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusCreated)
+	test.AssertEquals(t, responseWriter.Header().Get("Location"), "/acme/order/ready")
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"status":"pending","identifiers":[{"type":"dns","value":"not-an-example.com"}],"authorizations":["/acme/authz/bkrPh2u0JUf18-rVBZtOOWWb3GuIiliypL-hBM9Ak1Q"],"finalize":"/acme/finalize/ready"}`)
+
+	// Orders can be polled
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(OrderPath + "ready"),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"status":"ready","identifiers":[{"type":"dns","value":"not-an-example.com"}],"authorizations":["/acme/authz/valid"],"finalize":"/acme/finalize/ready"}`)
+
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(OrderPath + "missing"),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+
+	// Finalizing an order links to the certificate it issued
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(FinalizePath + "ready"),
+		Body: makeBody(signRequest(t, `{
+      "resource":"finalize",
+      "csr": "MIH1MIGiAgEAMA0xCzAJBgNVBAYTAlVTMFwwDQYJKoZIhvcNAQEBBQADSwAwSAJBAOXRzB9hDSCRPYjlu6HzJ9MkUPplDG-o0IS3ENiD8zcgCM-XvEEsse06CyhRb6g5Bz9AsGH9thaxszGB0o2RpakCAwEAAaAwMC4GCSqGSIb3DQEJDjEhMB8wHQYDVR0RBBYwFIISbm90LWFuLWV4YW1wbGUuY29tMAsGCSqGSIb3DQEBCwNBAFpyURFqjVn-7zx73GKaBvPF_2RhBsdehqSjaJ0BpvPKmzpoIFADjttNzKkWaRRDrTeT-GGMV2Gky8S-E_dzoms="
+    }`, &wfe.nonceService)),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"status":"valid","identifiers":[{"type":"dns","value":"not-an-example.com"}],"authorizations":["/acme/authz/valid"],"finalize":"/acme/finalize/ready","certificate":"/acme/cert/0000000000000000"}`)
+
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(FinalizePath + "missing"),
+		Body:   makeBody(signRequest(t, `{"resource":"finalize"}`, &wfe.nonceService)),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+}
+
 func TestRegistration(t *testing.T) {
 	wfe := setupWFE(t)
 	mux, err := wfe.Handler()
@@ -1169,8 +1649,245 @@ func TestRegistration(t *testing.T) {
 	links := responseWriter.Header()["Link"]
 	test.AssertEquals(t, contains(links, "</acme/new-authz>;rel=\"next\""), true)
 	test.AssertEquals(t, contains(links, "<"+agreementURL+">;rel=\"terms-of-service\""), true)
+	var reg core.Registration
+	err = json.Unmarshal([]byte(responseWriter.Body.String()), &reg)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned registration object")
+	test.AssertEquals(t, reg.Authorizations, "/acme/authz-list/1")
+	test.AssertEquals(t, reg.Certificates, "/acme/cert-list/1")
+
+	// Test POST with an unsupported status
+	responseWriter = httptest.NewRecorder()
+	nonce, err = wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Unable to create nonce")
+	result, err = signer.Sign([]byte(`{"resource":"reg","status":"revoked"}`), nonce)
+	wfe.Registration(responseWriter, &http.Request{
+		Method: "POST",
+		Body:   makeBody(result.FullSerialize()),
+		URL:    path,
+	})
+	test.AssertEquals(t, responseWriter.Code, 400)
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Invalid registration status [revoked]"}`)
+
+	// Test POST deactivating the registration
+	responseWriter = httptest.NewRecorder()
+	nonce, err = wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Unable to create nonce")
+	result, err = signer.Sign([]byte(`{"resource":"reg","status":"deactivated"}`), nonce)
+	wfe.Registration(responseWriter, &http.Request{
+		Method: "POST",
+		Body:   makeBody(result.FullSerialize()),
+		URL:    path,
+	})
+	test.AssertEquals(t, responseWriter.Code, 202)
+	err = json.Unmarshal([]byte(responseWriter.Body.String()), &reg)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned registration object")
+	test.AssertEquals(t, reg.Status, core.StatusDeactivated)
+}
+
+// deactivatedSA reports every registration as deactivated.
+type deactivatedSA struct {
+	MockSA
+}
+
+func (sa *deactivatedSA) GetRegistrationByKey(jwk jose.JsonWebKey) (core.Registration, error) {
+	reg, err := sa.MockSA.GetRegistrationByKey(jwk)
+	reg.Status = core.StatusDeactivated
+	return reg, err
+}
+
+func TestDeactivatedRegistration(t *testing.T) {
+	wfe := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &deactivatedSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+
+	key, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	test.Assert(t, ok, "Couldn't load RSA key")
+	signer, err := jose.NewSigner("RS256", rsaKey)
+	test.AssertNotError(t, err, "Failed to make signer")
+
+	for _, c := range []struct {
+		path     string
+		resource string
+	}{
+		{NewAuthzPath, "new-authz"},
+		{NewCertPath, "new-cert"},
+		{RegPath + "1", "reg"},
+		{NewRegPath, "new-reg"},
+	} {
+		nonce, err := wfe.nonceService.Nonce()
+		test.AssertNotError(t, err, "Unable to create nonce")
+		result, err := signer.Sign([]byte(`{"resource":"`+c.resource+`"}`), nonce)
+		test.AssertNotError(t, err, "Unable to sign")
+		responseWriter := httptest.NewRecorder()
+		mux.ServeHTTP(responseWriter, &http.Request{
+			Method: "POST",
+			Body:   makeBody(result.FullSerialize()),
+			URL:    mustParseURL(c.path),
+		})
+		test.AssertEquals(t, responseWriter.Code, 403)
+		test.AssertEquals(t,
+			responseWriter.Body.String(),
+			`{"type":"urn:acme:error:unauthorized","detail":"Registration has been deactivated"}`)
+	}
+}
+
+func TestRegistrationCollections(t *testing.T) {
+	wfe := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+	responseWriter := httptest.NewRecorder()
+
+	// Test GET returns 405
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(AuthzListPath + "1"),
+	})
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Method not allowed"}`)
+
+	key, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	signer, err := jose.NewSigner("RS256", key.(*rsa.PrivateKey))
+	test.AssertNotError(t, err, "Failed to make signer")
+	post := func(handler func(http.ResponseWriter, *http.Request), path, payload string) string {
+		nonce, err := wfe.nonceService.Nonce()
+		test.AssertNotError(t, err, "Unable to create nonce")
+		result, err := signer.Sign([]byte(payload), nonce)
+		test.AssertNotError(t, err, "Failed to sign request")
+		responseWriter = httptest.NewRecorder()
+		handler(responseWriter, &http.Request{
+			Method: "POST",
+			URL:    mustParseURL(path),
+			Body:   makeBody(result.FullSerialize()),
+		})
+		return responseWriter.Body.String()
+	}
+
+	// Another registration's collection
+	test.AssertEquals(t,
+		post(wfe.AuthorizationList, AuthzListPath+"2", `{"resource":"authorizations"}`),
+		`{"type":"urn:acme:error:unauthorized","detail":"Request signing key did not match registration key"}`)
+
+	// Wrong resource
+	test.AssertEquals(t,
+		post(wfe.AuthorizationList, AuthzListPath+"1", `{"resource":"certificates"}`),
+		`{"type":"urn:acme:error:malformed","detail":"Unable to read/verify body :: Request payload has invalid resource: certificates != authorizations"}`)
+
+	// Bad page
+	test.AssertEquals(t,
+		post(wfe.CertificateList, CertListPath+"1?page=-1", `{"resource":"certificates"}`),
+		`{"type":"urn:acme:error:malformed","detail":"Page must be a non-negative integer"}`)
+
+	test.AssertEquals(t,
+		post(wfe.AuthorizationList, AuthzListPath+"1", `{"resource":"authorizations"}`),
+		`{"authorizations":["/acme/authz/valid"]}`)
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), "")
+
+	test.AssertEquals(t,
+		post(wfe.CertificateList, CertListPath+"1", `{"resource":"certificates"}`),
+		`{"certificates":["/acme/cert/0000000000000000"]}`)
+
+	test.AssertEquals(t,
+		post(wfe.CertificateList, CertListPath+"1?page=1", `{"resource":"certificates"}`),
+		`{"certificates":[]}`)
+}
+
+func TestKeyChange(t *testing.T) {
+	wfe := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
 
+	wfe.RA = &MockRegistrationAuthority{}
+	wfe.SA = &MockSA{}
+	wfe.Stats, _ = statsd.NewNoopClient()
+	responseWriter := httptest.NewRecorder()
+
+	// Test GET returns 405
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(KeyChangePath),
+	})
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Method not allowed"}`)
 	responseWriter.Body.Reset()
+
+	key, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	oldSigner, err := jose.NewSigner("RS256", key.(*rsa.PrivateKey))
+	test.AssertNotError(t, err, "Failed to make signer")
+	key, err = jose.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	newSigner, err := jose.NewSigner("RS256", key.(*rsa.PrivateKey))
+	test.AssertNotError(t, err, "Failed to make signer")
+
+	keyChange := func(innerSigner jose.Signer, innerPayload string) string {
+		inner, err := innerSigner.Sign([]byte(innerPayload), "")
+		test.AssertNotError(t, err, "Failed to sign inner JWS")
+		nonce, err := wfe.nonceService.Nonce()
+		test.AssertNotError(t, err, "Unable to create nonce")
+		outer, err := oldSigner.Sign([]byte(`{"resource":"key-change","newKey":`+inner.FullSerialize()+`}`), nonce)
+		test.AssertNotError(t, err, "Failed to sign outer JWS")
+
+		responseWriter.Body.Reset()
+		wfe.KeyChange(responseWriter, &http.Request{
+			Method: "POST",
+			Body:   makeBody(outer.FullSerialize()),
+		})
+		return responseWriter.Body.String()
+	}
+
+	// Missing new key
+	nonce, err := wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Unable to create nonce")
+	result, err := oldSigner.Sign([]byte(`{"resource":"key-change"}`), nonce)
+	test.AssertNotError(t, err, "Failed to sign request")
+	wfe.KeyChange(responseWriter, &http.Request{
+		Method: "POST",
+		Body:   makeBody(result.FullSerialize()),
+	})
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Key change request does not contain a new key"}`)
+
+	// Inner JWS names another account
+	test.AssertEquals(t,
+		keyChange(newSigner, `{"account":"/acme/reg/2","oldKey":`+test1KeyPublicJSON+`}`),
+		`{"type":"urn:acme:error:malformed","detail":"Unable to verify new key :: New key JWS names the wrong account: /acme/reg/2 != /acme/reg/1"}`)
+
+	// Inner JWS names another old key
+	test.AssertEquals(t,
+		keyChange(newSigner, `{"account":"/acme/reg/1","oldKey":`+test2KeyPublicJSON+`}`),
+		`{"type":"urn:acme:error:malformed","detail":"Unable to verify new key :: New key JWS does not name the current account key"}`)
+
+	// New key already belongs to a registration
+	test.AssertEquals(t,
+		keyChange(oldSigner, `{"account":"/acme/reg/1","oldKey":`+test1KeyPublicJSON+`}`),
+		`{"type":"urn:acme:error:malformed","detail":"New key is already in use"}`)
+
+	// Successful key change
+	body := keyChange(newSigner, `{"account":"/acme/reg/1","oldKey":`+test1KeyPublicJSON+`}`)
+	test.AssertNotContains(t, body, "urn:acme:error")
+	var reg core.Registration
+	err = json.Unmarshal([]byte(body), &reg)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned registration")
+	var test2KeyPublic jose.JsonWebKey
+	test2KeyPublic.UnmarshalJSON([]byte(test2KeyPublicJSON))
+	test.Assert(t, core.KeyDigestEquals(reg.Key, test2KeyPublic), "Registration key was not changed")
+	test.AssertEquals(t, responseWriter.Header().Get("Location"), "/acme/reg/1")
 }
 
 func TestTermsRedirect(t *testing.T) {
@@ -1207,6 +1924,92 @@ func TestIssuer(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
 	test.Assert(t, bytes.Compare(responseWriter.Body.Bytes(), wfe.IssuerCert) == 0, "Incorrect bytes returned")
 	test.AssertEquals(t, responseWriter.Header().Get("Cache-Control"), "public, max-age=10")
+
+	// PEM on request
+	responseWriter = httptest.NewRecorder()
+	wfe.Issuer(responseWriter, &http.Request{
+		Method: "GET",
+		Header: http.Header{"Accept": {"application/x-pem-file"}},
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/x-pem-file")
+	test.AssertEquals(t, responseWriter.Body.String(), "-----BEGIN CERTIFICATE-----\nAAAB\n-----END CERTIFICATE-----\n")
+}
+
+func TestIssuerCerts(t *testing.T) {
+	wfe := setupWFE(t)
+	wfe.IssuerCert = []byte{0, 0, 1}
+
+	issuerKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "P-384 intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create issuer cert")
+	issuer, _ := x509.ParseCertificate(issuerDER)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, issuer, &leafKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create leaf cert")
+	leaf, _ := x509.ParseCertificate(leafDER)
+	wfe.IssuerCerts = [][]byte{issuerDER}
+	issuerPath := IssuerPath + "/" + issuerID(issuerDER)
+
+	// A certificate is linked to the intermediate that signed it
+	der, path := wfe.issuerOf(leaf)
+	test.Assert(t, bytes.Equal(der, issuerDER), "Wrong issuer for leaf")
+	test.AssertEquals(t, path, issuerPath)
+
+	// Other certificates get the default issuer
+	certPemBytes, _ := ioutil.ReadFile("test/178.crt")
+	certBlock, _ := pem.Decode(certPemBytes)
+	other, _ := x509.ParseCertificate(certBlock.Bytes)
+	der, path = wfe.issuerOf(other)
+	test.Assert(t, bytes.Equal(der, wfe.IssuerCert), "Wrong issuer for unknown certificate")
+	test.AssertEquals(t, path, IssuerPath)
+
+	// Each intermediate is served at its own path
+	responseWriter := httptest.NewRecorder()
+	url, _ := url.Parse(issuerPath)
+	wfe.Issuer(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    url,
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.Assert(t, bytes.Equal(responseWriter.Body.Bytes(), issuerDER), "Incorrect bytes returned")
+
+	responseWriter = httptest.NewRecorder()
+	url, _ = url.Parse(IssuerPath + "/0000000000000000")
+	wfe.Issuer(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    url,
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+}
+
+func TestNegotiateCertificateType(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":    "application/pkix-cert",
+		"*/*": "application/pkix-cert",
+		"text/html, application/pem-certificate-chain":                         "application/pem-certificate-chain",
+		"application/x-pem-file;q=0.5, application/pkix-cert":                  "application/pkix-cert",
+		"application/pkix-cert;q=0.2, application/pem-certificate-chain;q=0.9": "application/pem-certificate-chain",
+		"application/pem-certificate-chain;q=0":                                "application/pkix-cert",
+		"APPLICATION/X-PEM-FILE":                                               "application/x-pem-file",
+	} {
+		request := &http.Request{Header: http.Header{"Accept": {accept}}}
+		test.AssertEquals(t, negotiateCertificateType(request), expected)
+	}
 }
 
 func TestGetCertificate(t *testing.T) {
@@ -1231,6 +2034,25 @@ func TestGetCertificate(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/pkix-cert")
 	test.Assert(t, bytes.Compare(responseWriter.Body.Bytes(), certBlock.Bytes) == 0, "Certificates don't match")
 
+	// Full chain on request
+	wfe.IssuerCert = []byte{0, 0, 1}
+	responseWriter = httptest.NewRecorder()
+	wfe.Certificate(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    path,
+		Header: http.Header{"Accept": {"application/pem-certificate-chain"}},
+	})
+	test.AssertEquals(t, responseWriter.Code, 200)
+	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/pem-certificate-chain")
+	test.AssertEquals(t, responseWriter.Header().Get("Vary"), "Accept")
+	leaf, rest := pem.Decode(responseWriter.Body.Bytes())
+	test.Assert(t, leaf != nil, "Failed to decode leaf PEM")
+	test.Assert(t, bytes.Compare(leaf.Bytes, certBlock.Bytes) == 0, "Certificates don't match")
+	issuer, rest := pem.Decode(rest)
+	test.Assert(t, issuer != nil, "Failed to decode issuer PEM")
+	test.Assert(t, bytes.Compare(issuer.Bytes, wfe.IssuerCert) == 0, "Issuers don't match")
+	test.AssertEquals(t, len(rest), 0)
+
 	// Unused short serial, no cache
 	responseWriter = httptest.NewRecorder()
 	path, _ = url.Parse("/acme/cert/00000000000000ff")